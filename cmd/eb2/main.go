@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/esi"
 	"github.com/eveisesi/eb2/internal/server"
 	"github.com/eveisesi/eb2/internal/slack"
 	"github.com/eveisesi/eb2/internal/token"
@@ -41,7 +42,20 @@ func main() {
 
 	logger.SetLevel(loglvl)
 
-	slackServ := slack.New(logger, &cfg)
+	switch cfg.SlackTransport {
+	case eb2.SlackTransportHTTP:
+		// Requests posted to the http endpoints can't be verified without the signing secret
+		if cfg.SlackSigningSecret == "" {
+			logger.Fatal("SLACK_SIGNING_SECRET is required when the slack transport is http")
+		}
+	case eb2.SlackTransportSocket:
+	default:
+		logger.WithField("transport", cfg.SlackTransport).Fatal("unknown slack transport, expected http or socket")
+	}
+
+	esiServ := esi.New(logger, cfg.ESIUserAgent, cfg.ESIErrorLimitBuffer)
+
+	slackServ := slack.New(logger, &cfg, esiServ)
 
 	tokenServ := token.New("", cfg.EveClientID, cfg.EveClientSecret)
 
@@ -65,12 +79,26 @@ func main() {
 		errChan <- server.Run()
 	}()
 
+	socketCtx, stopSocket := context.WithCancel(context.Background())
+	defer stopSocket()
+
+	if cfg.SlackTransport == eb2.SlackTransportSocket {
+		go func() {
+			err := server.RunSocketMode(socketCtx)
+			if err != nil {
+				logger.WithError(err).Fatal("failed to run socket mode")
+			}
+		}()
+	}
+
 	select {
 	case err := <-errChan:
 		logger.WithError(err).Fatal("error encountered attempting to start the http server")
 	case <-signals:
 		logger.Info("starting server shutdown procedure....")
 
+		stopSocket()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
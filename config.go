@@ -1,19 +1,50 @@
 package eb2
 
+import "time"
+
+const (
+	// SlackTransportHTTP receives events, interactions and slash commands on the http endpoints of the api
+	SlackTransportHTTP = "http"
+	// SlackTransportSocket receives them over a Socket Mode connection, no public endpoint is needed
+	SlackTransportSocket = "socket"
+)
+
 type Config struct {
 	SlackAPIToken         string   `envconfig:"SLACK_API_TOKEN" required:"true"`
-	SlackSigningSecret    string   `envconfig:"SLACK_SIGNING_SECRET" required:"true"`
+	SlackSigningSecret    string   `envconfig:"SLACK_SIGNING_SECRET"`
 	SlackPingChannels     []string `envconfig:"SLACK_PING_CHANNELS" required:"true" split_words:"true"`
 	SlackPrefixes         []string `envconfig:"SLACK_PREFIXES" required:"true" split_words:"true"`
 	SlackSendStartupMsg   bool     `envconfig:"SLACK_SEND_STARTUP_MSG" default:"true"`
 	SlackModChannel       string   `envconfig:"SLACK_MOD_CHANNEL" required:"true"`
 	SlackESIChannel       string   `envconfig:"SLACK_ESI_CHANNEL" required:"true"`
 	SlackESIStatusChannel string   `envconfig:"SLACK_ESISTATUS_CHANNEL" required:"true"`
+	SlackUnfurlChannels   []string `envconfig:"SLACK_UNFURL_CHANNELS" split_words:"true"`
+	SlackTransport        string   `envconfig:"SLACK_TRANSPORT" default:"http"`
+	SlackAppToken         string   `envconfig:"SLACK_APP_TOKEN"`
+	SlackAPIURL           string   `envconfig:"SLACK_API_URL" default:"https://slack.com/api/"`
 
 	EveClientID     string `envconfig:"EVE_CLIENT_ID" required:"true"`
 	EveClientSecret string `envconfig:"EVE_CLIENT_SECRET" required:"true"`
 	EveCallback     string `envconfig:"EVE_CALLBACK" required:"true"`
 
+	ESIUserAgent        string `envconfig:"ESI_USER_AGENT" default:"esi-bot-v2 (+https://github.com/eveisesi/esi-bot-v2)"`
+	ESIErrorLimitBuffer int    `envconfig:"ESI_ERROR_LIMIT_BUFFER" default:"10"`
+
+	DogmaCachePath string `envconfig:"DOGMA_CACHE_PATH" default:"dogma.json"`
+
+	ZKillboardURL string `envconfig:"ZKILLBOARD_URL" default:"https://zkillboard.com"`
+
+	GithubToken           string `envconfig:"GITHUB_TOKEN"`
+	GithubAPIURL          string `envconfig:"GITHUB_API_URL" default:"https://api.github.com/"`
+	GithubRateLimitBuffer int    `envconfig:"GITHUB_RATE_LIMIT_BUFFER" default:"10"`
+
+	GithubFeedChannel   string        `envconfig:"GITHUB_FEED_CHANNEL"`
+	GithubFeedInterval  time.Duration `envconfig:"GITHUB_FEED_INTERVAL" default:"10m"`
+	GithubFeedStatePath string        `envconfig:"GITHUB_FEED_STATE_PATH" default:"github_feed.json"`
+
+	GithubWebhookSecret   string            `envconfig:"GITHUB_WEBHOOK_SECRET"`
+	GithubWebhookChannels map[string]string `envconfig:"GITHUB_WEBHOOK_CHANNELS"`
+
 	ApiPort uint `envconfig:"API_PORT" default:"5000"`
 
 	AppVersion string `envconfig:"APP_VERSION" required:"true"`
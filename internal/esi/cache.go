@@ -0,0 +1,88 @@
+package esi
+
+import (
+	"net/http"
+	"time"
+)
+
+// revalidateWindow is how long an expired response is kept around so that it
+// can be revalidated with If-None-Match instead of being fetched again in full
+const revalidateWindow = time.Hour
+
+type cacheEntry struct {
+	status  string
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func (e *cacheEntry) fresh() bool {
+	return time.Now().Before(e.expires)
+}
+
+func (e *cacheEntry) response() *Response {
+	return &Response{
+		StatusCode: http.StatusOK,
+		Status:     e.status,
+		Header:     e.header,
+		Body:       e.body,
+		Cached:     true,
+		Expires:    e.expires,
+	}
+}
+
+func (s *service) cached(key string) *cacheEntry {
+	entry, found := s.cache.Get(key)
+	if !found {
+		return nil
+	}
+
+	return entry.(*cacheEntry)
+}
+
+// store caches a successful response when ESI has told us how long it is good for.
+// Responses without an Expires header are never cached
+func (s *service) store(key string, resp *Response) {
+
+	if resp.Expires.IsZero() || !resp.Expires.After(time.Now()) {
+		return
+	}
+
+	s.cache.Set(key, &cacheEntry{
+		status:  resp.Status,
+		header:  resp.Header,
+		body:    resp.Body,
+		etag:    resp.Header.Get("Etag"),
+		expires: resp.Expires,
+	}, time.Until(resp.Expires)+revalidateWindow)
+
+}
+
+// revalidated refreshes an entry after ESI answered a conditional request with a 304
+func (s *service) revalidated(key string, entry *cacheEntry, header http.Header) *Response {
+
+	expires := parseExpires(header)
+	if expires.IsZero() {
+		return entry.response()
+	}
+
+	refreshed := *entry
+	refreshed.expires = expires
+	if etag := header.Get("Etag"); etag != "" {
+		refreshed.etag = etag
+	}
+
+	s.cache.Set(key, &refreshed, time.Until(expires)+revalidateWindow)
+
+	return refreshed.response()
+}
+
+func parseExpires(header http.Header) time.Time {
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return expires
+}
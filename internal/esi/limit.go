@@ -0,0 +1,182 @@
+package esi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	headerErrorLimitRemain = "X-Esi-Error-Limit-Remain"
+	headerErrorLimitReset  = "X-Esi-Error-Limit-Reset"
+
+	// statusErrorLimited is the status ESI responds with once the error budget is exhausted
+	statusErrorLimited = 420
+
+	// errorLimitWindow is used as the reset when ESI error limits us without telling us when the window resets
+	errorLimitWindow = time.Minute
+
+	// probeTimeout is how long requests wait on the request probing a new error window
+	// before one of them takes over, i.e. because the probe never got a response
+	probeTimeout = time.Second * 5
+)
+
+// State is a snapshot of the error budget an ESI host has reported to us along
+// with a few counters describing how the client has behaved since startup
+type State struct {
+	// Known is false until ESI has sent back the error limit headers at least once
+	Known  bool
+	Remain int
+	Reset  time.Time
+	Buffer int
+
+	// PausedUntil is set while requests are being held back to protect the error budget
+	PausedUntil time.Time
+
+	Requests uint64
+	Retries  uint64
+	Pauses   uint64
+}
+
+type tracker struct {
+	mu sync.Mutex
+
+	buffer int
+	known  bool
+	remain int
+	reset  time.Time
+	paused time.Time
+
+	// probing is set while a single request is sent to learn the error budget of a window
+	// that reset while the last known budget was still exhausted. updated is closed and
+	// replaced every time ESI reports the error limit so waiting requests can recheck it
+	probing time.Time
+	updated chan struct{}
+
+	requests uint64
+	retries  uint64
+	pauses   uint64
+}
+
+func newTracker(buffer int) *tracker {
+	return &tracker{
+		buffer:  buffer,
+		updated: make(chan struct{}),
+	}
+}
+
+// wait blocks until it is safe to send another request to ESI. It returns
+// immediately unless the remaining error budget has dropped to the buffer.
+// While the error window has not reset yet every request waits for it to do so.
+// Once it has, a single request is let through to learn the new budget and the
+// others wait for its response before checking the budget again
+func (t *tracker) wait(ctx context.Context, logger *logrus.Logger) error {
+
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		if !t.known || t.remain > t.buffer {
+			t.mu.Unlock()
+			return nil
+		}
+
+		var until time.Time
+		switch {
+		case now.Before(t.reset):
+			until = t.reset
+			if t.paused.Before(until) {
+				t.pauses++
+				t.paused = until
+				logger.WithFields(logrus.Fields{
+					"remain": t.remain,
+					"until":  until.Format(time.RFC3339),
+				}).Warn("esi error limit is nearly exhausted, pausing requests")
+			}
+		case t.probing.IsZero() || now.Sub(t.probing) > probeTimeout:
+			t.probing = now
+			t.mu.Unlock()
+			return nil
+		default:
+			until = t.probing.Add(probeTimeout)
+		}
+		updated := t.updated
+		t.mu.Unlock()
+
+		timer := time.NewTimer(until.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-updated:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+}
+
+func (t *tracker) update(status int, header http.Header) {
+
+	remain, errRemain := strconv.Atoi(header.Get(headerErrorLimitRemain))
+	reset, errReset := strconv.Atoi(header.Get(headerErrorLimitReset))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if errRemain == nil && errReset == nil {
+		t.known = true
+		t.remain = remain
+		t.reset = now.Add(time.Duration(reset) * time.Second)
+	}
+
+	if status == statusErrorLimited {
+		t.known = true
+		t.remain = 0
+		if !t.reset.After(now) {
+			t.reset = now.Add(errorLimitWindow)
+		}
+	}
+
+	t.probing = time.Time{}
+	close(t.updated)
+	t.updated = make(chan struct{})
+
+}
+
+func (t *tracker) request() {
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+}
+
+func (t *tracker) retry() {
+	t.mu.Lock()
+	t.retries++
+	t.mu.Unlock()
+}
+
+func (t *tracker) state() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := State{
+		Known:    t.known,
+		Remain:   t.remain,
+		Reset:    t.reset,
+		Buffer:   t.buffer,
+		Requests: t.requests,
+		Retries:  t.retries,
+		Pauses:   t.pauses,
+	}
+
+	if time.Now().Before(t.paused) {
+		state.PausedUntil = t.paused
+	}
+
+	return state
+}
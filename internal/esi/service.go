@@ -0,0 +1,268 @@
+package esi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxAttempts is the total number of times a request is sent when ESI
+	// keeps answering with a gateway error
+	maxAttempts = 4
+	backoffBase = 250 * time.Millisecond
+	backoffMax  = 5 * time.Second
+)
+
+type (
+	Service interface {
+		Do(ctx context.Context, req *http.Request) (*Response, error)
+		Get(ctx context.Context, uri string) (*Response, error)
+		Post(ctx context.Context, uri string, body interface{}) (*Response, error)
+		State() map[string]State
+	}
+
+	service struct {
+		logger    *logrus.Logger
+		client    *http.Client
+		userAgent string
+		cache     *cache.Cache
+
+		// Every ESI host keeps its own error budget, so requests are tracked per host
+		mu       sync.Mutex
+		buffer   int
+		trackers map[string]*tracker
+	}
+
+	// Response is a fully read ESI response. The body is read and the
+	// connection released before the Response is handed back to the caller
+	Response struct {
+		StatusCode int
+		Status     string
+		Header     http.Header
+		Body       []byte
+		Duration   time.Duration
+		Attempts   int
+
+		// Cached is true when the body was served from the response cache,
+		// either because it had not expired yet or because ESI revalidated it
+		Cached  bool
+		Expires time.Time
+	}
+)
+
+func New(logger *logrus.Logger, userAgent string, errorLimitBuffer int) Service {
+	return &service{
+		logger: logger,
+		client: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		userAgent: userAgent,
+		cache:     cache.New(cache.NoExpiration, time.Minute*10),
+		buffer:    errorLimitBuffer,
+		trackers:  make(map[string]*tracker),
+	}
+}
+
+// tracker returns the error limit tracker of the host, creating it on the first request to the host
+func (s *service) tracker(host string) *tracker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.trackers[host]
+	if !ok {
+		t = newTracker(s.buffer)
+		s.trackers[host] = t
+	}
+
+	return t
+}
+
+func (s *service) Get(ctx context.Context, uri string) (*Response, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build esi request")
+	}
+
+	return s.Do(ctx, req)
+}
+
+// Post sends the body to ESI encoded as JSON
+func (s *service) Post(ctx context.Context, uri string, body interface{}) (*Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode esi request body")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build esi request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.Do(ctx, req)
+}
+
+// Do sends the request to ESI. GET requests are answered from the response cache
+// until the Expires header ESI sent with them has passed, after which they are
+// revalidated with If-None-Match. Requests that already carry an If-None-Match
+// header are left for the caller to handle and bypass the cache.
+func (s *service) Do(ctx context.Context, req *http.Request) (*Response, error) {
+
+	req = req.Clone(ctx)
+	req.Header.Set("User-Agent", s.userAgent)
+
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" {
+		return s.send(ctx, req)
+	}
+
+	start := time.Now()
+	key := req.URL.String()
+	entry := s.cached(key)
+	if entry != nil {
+		if entry.fresh() {
+			resp := entry.response()
+			resp.Duration = time.Since(start)
+			return resp, nil
+		}
+
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+	}
+
+	resp, err := s.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		cached := s.revalidated(key, entry, resp.Header)
+		cached.Duration = resp.Duration
+		cached.Attempts = resp.Attempts
+		return cached, nil
+	case resp.StatusCode == http.StatusOK:
+		s.store(key, resp)
+	}
+
+	return resp, nil
+
+}
+
+// send makes the request to ESI. Before every attempt the error budget of the host is checked
+// and, if it is about to be exhausted, send blocks until the window resets.
+// 502, 503 and 504 responses are retried with a jittered exponential backoff;
+// any other status is returned to the caller as is.
+func (s *service) send(ctx context.Context, req *http.Request) (*Response, error) {
+
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		payload, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read esi request body")
+		}
+		req.Body.Close()
+	}
+
+	tracker := s.tracker(req.URL.Host)
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := tracker.wait(ctx, s.logger)
+		if err != nil {
+			return nil, err
+		}
+
+		if payload != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+		}
+
+		tracker.request()
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to make request to %s", req.URL.String())
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read response from %s", req.URL.String())
+		}
+
+		tracker.update(resp.StatusCode, resp.Header)
+
+		if !retryable(resp.StatusCode) || attempt == maxAttempts {
+			return &Response{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+				Header:     resp.Header,
+				Body:       data,
+				Duration:   time.Since(start),
+				Attempts:   attempt,
+				Expires:    parseExpires(resp.Header),
+			}, nil
+		}
+
+		delay := backoff(attempt)
+		tracker.retry()
+		s.logger.WithFields(logrus.Fields{
+			"url":     req.URL.String(),
+			"status":  resp.StatusCode,
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).Warn("esi responded with a gateway error, retrying request")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+}
+
+// State returns the error budget of every host a request has been sent to, keyed by host
+func (s *service) State() map[string]State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]State, len(s.trackers))
+	for host, t := range s.trackers {
+		states[host] = t.state()
+	}
+
+	return states
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the next attempt. The delay doubles on each
+// attempt and is jittered between half and the full value so that concurrent
+// callers don't hit ESI again in lock step
+func backoff(attempt int) time.Duration {
+	d := backoffBase << uint(attempt-1)
+	if d > backoffMax {
+		d = backoffMax
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,422 @@
+package esi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+func hostOf(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// errorLimited writes the error limit headers ESI sends with every response
+func errorLimited(w http.ResponseWriter, remain, reset int) {
+	w.Header().Set(headerErrorLimitRemain, strconv.Itoa(remain))
+	w.Header().Set(headerErrorLimitReset, strconv.Itoa(reset))
+}
+
+func TestSendRetriesGatewayErrors(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if r.Header.Get("User-Agent") != "eb2-test" {
+			t.Errorf("expected the user agent to be set, got %q", r.Header.Get("User-Agent"))
+		}
+
+		errorLimited(w, 100, 60)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	start := time.Now()
+	resp, err := s.Get(context.Background(), api.URL+"/v1/status/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	took := time.Since(start)
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected the last 502 to be returned, got %d", resp.StatusCode)
+	}
+	if resp.Attempts != maxAttempts || atomic.LoadInt32(&attempts) != maxAttempts {
+		t.Errorf("expected %d attempts, reported %d and the server saw %d", maxAttempts, resp.Attempts, attempts)
+	}
+
+	// Every delay is jittered between half and the full backoff of its attempt
+	var least, most time.Duration
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		d := backoffBase << uint(attempt-1)
+		least += d / 2
+		most += d
+	}
+	if took < least || took > most+time.Second {
+		t.Errorf("expected the retries to back off for between %s and %s, took %s", least, most, took)
+	}
+
+	state := s.State()[hostOf(api)]
+	if state.Requests != maxAttempts || state.Retries != maxAttempts-1 {
+		t.Errorf("expected %d requests and %d retries, got %+v", maxAttempts, maxAttempts-1, state)
+	}
+
+}
+
+func TestSendStopsRetryingOnSuccess(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorLimited(w, 100, 60)
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"players":24000}`))
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	resp, err := s.Get(context.Background(), api.URL+"/v1/status/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Attempts != 2 || string(resp.Body) != `{"players":24000}` {
+		t.Errorf("expected the second attempt to succeed, got %d after %d attempts: %s", resp.StatusCode, resp.Attempts, resp.Body)
+	}
+
+}
+
+func TestWaitPausesUntilErrorWindowResets(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			errorLimited(w, 5, 1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		errorLimited(w, 100, 60)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	_, err := s.Get(context.Background(), api.URL+"/v4/characters/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := s.State()[hostOf(api)]
+	if !state.Known || state.Remain != 5 {
+		t.Fatalf("expected the error limit headers to be tracked, got %+v", state)
+	}
+
+	// A request that can't wait for the window to reset gives up without reaching ESI
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	_, err = s.Get(ctx, api.URL+"/v4/characters/2/")
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the paused request to give up when its context expires, got %v", err)
+	}
+	if paused := s.State()[hostOf(api)].PausedUntil; paused.IsZero() {
+		t.Error("expected the state to report the pause")
+	}
+
+	start := time.Now()
+	_, err = s.Get(context.Background(), api.URL+"/v4/characters/3/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < time.Millisecond*500 {
+		t.Errorf("expected the request to be held back until the error window reset, took %s", took)
+	}
+
+	if sent := atomic.LoadInt32(&attempts); sent != 2 {
+		t.Errorf("expected only the request sent after the reset to reach ESI, %d requests did", sent)
+	}
+
+	state = s.State()[hostOf(api)]
+	if state.Pauses != 1 || state.Remain != 100 || !state.PausedUntil.IsZero() {
+		t.Errorf("expected a single pause and requests to resume, got %+v", state)
+	}
+
+}
+
+func TestErrorLimitIsTrackedPerHost(t *testing.T) {
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorLimited(w, 5, 30)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer limited.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorLimited(w, 100, 30)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer healthy.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	_, err := s.Get(context.Background(), limited.URL+"/v4/characters/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The exhausted budget of one host must not hold back requests to the other
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err = s.Get(ctx, healthy.URL+"/v4/characters/1/")
+	if err != nil {
+		t.Fatalf("expected the request to the other host to go out, got %s", err)
+	}
+
+	states := s.State()
+	if len(states) != 2 {
+		t.Fatalf("expected a state for both hosts, got %+v", states)
+	}
+	if state := states[hostOf(limited)]; state.Remain != 5 || state.Requests != 1 {
+		t.Errorf("unexpected state for the limited host %+v", state)
+	}
+	if state := states[hostOf(healthy)]; state.Remain != 100 || state.Requests != 1 || state.Pauses != 0 {
+		t.Errorf("unexpected state for the healthy host %+v", state)
+	}
+
+}
+
+// TestWaitRechecksAfterErrorWindowResets keeps reporting an exhausted error budget after every reset.
+// Only a single request may probe each new window, the others have to wait for it to come back
+func TestWaitRechecksAfterErrorWindowResets(t *testing.T) {
+
+	var mu sync.Mutex
+	var arrived []time.Time
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrived = append(arrived, time.Now())
+		mu.Unlock()
+
+		errorLimited(w, 5, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	_, err := s.Get(context.Background(), api.URL+"/v4/characters/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 2; i <= 3; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			_, err := s.Get(context.Background(), api.URL+"/v4/characters/"+strconv.Itoa(id)+"/")
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(arrived) != 3 {
+		t.Fatalf("expected 3 requests to reach ESI, got %d", len(arrived))
+	}
+	for i := 1; i < len(arrived); i++ {
+		if gap := arrived[i].Sub(arrived[i-1]); gap < time.Millisecond*500 {
+			t.Errorf("expected request %d to wait for the next error window, it followed the previous one after %s", i+1, gap)
+		}
+	}
+
+}
+
+// expire moves the cached response for the key past its Expires header
+func expire(t *testing.T, s *service, key string) {
+	t.Helper()
+
+	entry := s.cached(key)
+	if entry == nil {
+		t.Fatalf("expected %s to be cached", key)
+	}
+
+	expired := *entry
+	expired.expires = time.Now().Add(-time.Minute)
+	s.cache.Set(key, &expired, revalidateWindow)
+}
+
+func TestDoServesFreshResponsesFromCache(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("Etag", `"a1b2c3"`)
+		_, _ = w.Write([]byte(`{"players":24000}`))
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10)
+
+	first, err := s.Get(context.Background(), api.URL+"/v1/status/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Get(context.Background(), api.URL+"/v1/status/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := atomic.LoadInt32(&attempts); sent != 1 {
+		t.Errorf("expected the second request to be served from the cache, %d requests reached ESI", sent)
+	}
+	if first.Cached || !second.Cached {
+		t.Errorf("expected only the second response to be cached, got %t and %t", first.Cached, second.Cached)
+	}
+	if second.StatusCode != http.StatusOK || string(second.Body) != `{"players":24000}` {
+		t.Errorf("unexpected cached response %d: %s", second.StatusCode, second.Body)
+	}
+
+}
+
+func TestDoRevalidatesExpiredResponses(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("Etag", `"a1b2c3"`)
+
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			_, _ = w.Write([]byte(`{"players":24000}`))
+			return
+		}
+
+		if r.Header.Get("If-None-Match") != `"a1b2c3"` {
+			t.Errorf("expected the expired response to be revalidated with its etag, got %q", r.Header.Get("If-None-Match"))
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10).(*service)
+
+	uri := api.URL + "/v1/status/"
+	_, err := s.Get(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expire(t, s, uri)
+
+	resp, err := s.Get(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := atomic.LoadInt32(&attempts); sent != 2 {
+		t.Errorf("expected the expired response to be revalidated, %d requests reached ESI", sent)
+	}
+	if resp.StatusCode != http.StatusOK || !resp.Cached || string(resp.Body) != `{"players":24000}` {
+		t.Errorf("expected the cached body to be returned after a 304, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if entry := s.cached(uri); entry == nil || !entry.fresh() {
+		t.Error("expected the 304 to extend the cached response")
+	}
+
+}
+
+func TestDoRefetchesExpiredResponsesWithoutEtag(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("expected a response without an etag to be fetched in full, got If-None-Match %q", r.Header.Get("If-None-Match"))
+		}
+
+		w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(`{"players":` + strconv.Itoa(int(atomic.AddInt32(&attempts, 1))) + `}`))
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10).(*service)
+
+	uri := api.URL + "/v1/status/"
+	_, err := s.Get(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expire(t, s, uri)
+
+	resp, err := s.Get(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Cached || string(resp.Body) != `{"players":2}` {
+		t.Errorf("expected the expired response to be fetched again, got %s", resp.Body)
+	}
+	if entry := s.cached(uri); entry == nil || string(entry.body) != `{"players":2}` {
+		t.Error("expected the new response to replace the expired one")
+	}
+
+}
+
+func TestDoDoesNotCacheErrors(t *testing.T) {
+
+	var attempts int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("Etag", `"a1b2c3"`)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"Type not found!"}`))
+	}))
+	defer api.Close()
+
+	s := New(newTestLogger(), "eb2-test", 10).(*service)
+
+	uri := api.URL + "/latest/universe/types/1/"
+	for i := 0; i < 2; i++ {
+		resp, err := s.Get(context.Background(), uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusNotFound || resp.Cached {
+			t.Errorf("expected the 404 to be returned as is, got %d (cached %t)", resp.StatusCode, resp.Cached)
+		}
+	}
+
+	if sent := atomic.LoadInt32(&attempts); sent != 2 {
+		t.Errorf("expected every request for the missing type to reach ESI, %d did", sent)
+	}
+	if s.cached(uri) != nil {
+		t.Error("expected the 404 not to be cached")
+	}
+
+}
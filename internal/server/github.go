@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// githubSignatureHeader carries the HMAC SHA256 hexdigest of the body, keyed with the webhook secret
+	githubSignatureHeader = "X-Hub-Signature-256"
+
+	// githubEventTimeout caps how long posting a webhook event to Slack may take
+	githubEventTimeout = time.Second * 30
+)
+
+func (s *server) handlePostGithubWebhook(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	if s.config.GithubWebhookSecret == "" {
+		s.writeError(ctx, w, errors.New("github webhooks are not configured"), http.StatusNotFound)
+		return
+	}
+
+	signature := r.Header.Get(githubSignatureHeader)
+	if signature == "" {
+		s.writeError(ctx, w, errors.Errorf("missing %s header", githubSignatureHeader), http.StatusBadRequest)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		s.writeError(ctx, w, err, http.StatusInternalServerError)
+		return
+	}
+
+	body := buf.Bytes()
+	err = verifyGithubSignature(signature, body, s.config.GithubWebhookSecret)
+	if err != nil {
+		s.writeError(ctx, w, err, http.StatusUnauthorized)
+		return
+	}
+
+	eventType := github.WebHookType(r)
+	if eventType == "ping" {
+		s.writeSuccess(ctx, w, nil, http.StatusOK)
+		return
+	}
+
+	payload, err := github.ParseWebHook(eventType, body)
+	if err != nil {
+		s.writeError(ctx, w, errors.Wrap(err, "failed to parse webhook payload"), http.StatusBadRequest)
+		return
+	}
+
+	// The request context is cancelled as soon as GitHub has been answered, so the event is posted with a context of its own
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), githubEventTimeout)
+		defer cancel()
+
+		s.slack.ProcessGithubEvent(ctx, eventType, payload)
+	}()
+
+	s.writeSuccess(ctx, w, nil, http.StatusAccepted)
+
+}
+
+// verifyGithubSignature checks the signature Github sent along with the body. Only SHA256 signatures are accepted
+func verifyGithubSignature(signature string, body []byte, secret string) error {
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		return errors.Errorf("invalid %s header", githubSignatureHeader)
+	}
+
+	err := github.ValidateSignature(signature, body, []byte(secret))
+	if err != nil {
+		return errors.Wrap(err, "failed to verify webhook signature")
+	}
+
+	return nil
+
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/slack"
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSlack records what the handlers hand over to the slack service
+type fakeSlack struct {
+	mu           sync.Mutex
+	events       []*slackevents.MessageEvent
+	commands     []nslack.SlashCommand
+	interactions []*slack.Interaction
+	github       []string
+	received     chan struct{}
+}
+
+func newFakeSlack() *fakeSlack {
+	return &fakeSlack{received: make(chan struct{}, 16)}
+}
+
+func (f *fakeSlack) Run() {}
+
+func (f *fakeSlack) ProcessEvent(ctx context.Context, event *slackevents.MessageEvent) {
+	f.mu.Lock()
+	f.events = append(f.events, event)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+}
+
+func (f *fakeSlack) ProcessSlashCommand(ctx context.Context, command nslack.SlashCommand) {
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+}
+
+func (f *fakeSlack) ProcessInteraction(ctx context.Context, interaction *slack.Interaction) {
+	f.mu.Lock()
+	f.interactions = append(f.interactions, interaction)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+}
+
+func (f *fakeSlack) ProcessGithubEvent(ctx context.Context, eventType string, payload interface{}) {
+	f.mu.Lock()
+	f.github = append(f.github, eventType)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+}
+
+// wait blocks until the service has been handed n things, failing the test if that takes too long
+func (f *fakeSlack) wait(t *testing.T, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-f.received:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for the slack service to receive %d calls", n)
+		}
+	}
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+func signGithubPayload(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandlePostGithubWebhook(t *testing.T) {
+
+	const secret = "It's a secret to everybody"
+
+	body, err := ioutil.ReadFile(filepath.Join("..", "slack", "testdata", "github", "issues.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		status    int
+		delivered bool
+	}{
+		{name: "valid signature", signature: signGithubPayload(body, secret), status: http.StatusAccepted, delivered: true},
+		{name: "bad signature", signature: signGithubPayload(body, "not the secret"), status: http.StatusUnauthorized},
+		{name: "sha1 signature", signature: "sha1=2fd4e1c67a2d28fced849ee1bb76e7391b93eb12", status: http.StatusUnauthorized},
+		{name: "missing signature", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			fake := newFakeSlack()
+			s := &server{
+				config: &eb2.Config{GithubWebhookSecret: secret},
+				logger: newTestLogger(),
+				slack:  fake,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/github/webhook", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", "issues")
+			if tt.signature != "" {
+				req.Header.Set(githubSignatureHeader, tt.signature)
+			}
+
+			w := httptest.NewRecorder()
+			s.handlePostGithubWebhook(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if !tt.delivered {
+				return
+			}
+
+			fake.wait(t, 1)
+			if len(fake.github) != 1 || fake.github[0] != "issues" {
+				t.Errorf("expected the issues event to be handed to the slack service, got %v", fake.github)
+			}
+
+		})
+	}
+
+}
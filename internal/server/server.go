@@ -31,7 +31,7 @@ func NewServer(config *eb2.Config, logger *logrus.Logger, slack slack.Service, t
 		logger:  logger,
 		slack:   slack,
 		token:   token,
-		goslack: nslack.New(config.SlackAPIToken),
+		goslack: nslack.New(config.SlackAPIToken, nslack.OptionAPIURL(config.SlackAPIURL)),
 	}
 }
 
@@ -66,7 +66,13 @@ func (s *server) BuildRouter() http.Handler {
 		r.Use(s.CheckJWT)
 		r.Post("/slack/invite/send", s.handlePostSlackInviteSend)
 	})
-	r.Post("/slack", s.handlePostSlack)
+	// Socket Mode delivers these over its connection, so they are only exposed when Slack posts them to us
+	if s.config.SlackTransport != eb2.SlackTransportSocket {
+		r.Post("/slack", s.handlePostSlack)
+		r.Post("/slack/interactive", s.handlePostSlackInteractive)
+		r.Post("/slack/commands", s.handlePostSlackCommand)
+	}
+	r.Post("/github/webhook", s.handlePostGithubWebhook)
 
 	return r
 
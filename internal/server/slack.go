@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/eveisesi/eb2/internal/slack"
 	"github.com/eveisesi/eb2/pkg/tools"
 	nslack "github.com/nlopes/slack"
 	"github.com/nlopes/slack/slackevents"
@@ -55,13 +57,70 @@ func (s *server) handlePostSlack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go func(event slackevents.EventsAPIEvent) {
-		// Delay for dramatic effect
-		switch e := event.InnerEvent.Data.(type) {
-		case *slackevents.MessageEvent:
-			s.slack.ProcessEvent(ctx, e)
-		}
-	}(event)
+	go s.dispatchSlackEvent(ctx, event)
+
+	s.writeSuccess(ctx, w, nil, http.StatusOK)
+
+}
+
+// dispatchSlackEvent hands an Events API event to the slack service. Events come in through
+// the /slack endpoint or over the Socket Mode connection, both end up here
+func (s *server) dispatchSlackEvent(ctx context.Context, event slackevents.EventsAPIEvent) {
+	switch e := event.InnerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		s.slack.ProcessEvent(ctx, e)
+	}
+}
+
+func (s *server) handlePostSlackInteractive(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	err := verifySlackReqeust(r, s.config.SlackSigningSecret)
+	if err != nil {
+		s.writeError(ctx, w, err, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		s.writeError(ctx, w, err, http.StatusBadRequest)
+		return
+	}
+
+	var interaction slack.Interaction
+	err = json.Unmarshal([]byte(r.PostForm.Get("payload")), &interaction)
+	if err != nil {
+		s.writeError(ctx, w, errors.Wrap(err, "failed to decode interaction payload"), http.StatusBadRequest)
+		return
+	}
+
+	// Slack expects an acknowledgement within three seconds, so the interaction is handled after responding
+	go s.slack.ProcessInteraction(ctx, &interaction)
+
+	s.writeSuccess(ctx, w, nil, http.StatusOK)
+
+}
+
+func (s *server) handlePostSlackCommand(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	err := verifySlackReqeust(r, s.config.SlackSigningSecret)
+	if err != nil {
+		s.writeError(ctx, w, err, http.StatusBadRequest)
+		return
+	}
+
+	command, err := nslack.SlashCommandParse(r)
+	if err != nil {
+		s.writeError(ctx, w, errors.Wrap(err, "failed to parse slash command"), http.StatusBadRequest)
+		return
+	}
+
+	// Slack gives up on slash commands after three seconds, so the command is acknowledged right away
+	// and answers through its response url once it is done
+	go s.slack.ProcessSlashCommand(ctx, command)
 
 	s.writeSuccess(ctx, w, nil, http.StatusOK)
 
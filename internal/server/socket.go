@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eveisesi/eb2/internal/slack"
+	"github.com/gorilla/websocket"
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// socketReadTimeout is how long the connection may stay silent. Slack pings every few
+	// seconds, a connection that hasn't heard from it in this long is considered dead
+	socketReadTimeout = time.Minute
+
+	// socketBackoffBase and socketBackoffMax bound the delay before reconnecting after a failure
+	socketBackoffBase = time.Second
+	socketBackoffMax  = time.Second * 30
+)
+
+// socketEnvelope wraps everything Slack sends over a Socket Mode connection. Every envelope that
+// carries an envelope id has to be acknowledged within three seconds
+type socketEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type socketAck struct {
+	EnvelopeID string `json:"envelope_id"`
+}
+
+type socketOpenResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	URL   string `json:"url"`
+}
+
+// RunSocketMode receives events, interactions and slash commands over a Socket Mode connection instead of
+// the public endpoints, so the bot can run without being reachable from the internet. It reconnects whenever
+// the connection drops or Slack asks it to, and only returns once the context is cancelled
+func (s *server) RunSocketMode(ctx context.Context) error {
+
+	if s.config.SlackAppToken == "" {
+		return errors.New("socket mode requires SLACK_APP_TOKEN to be set")
+	}
+
+	failures := 0
+	for {
+		err := s.runSocketConnection(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		delay := time.Duration(0)
+		if err != nil {
+			failures++
+			delay = socketBackoffBase << uint(failures-1)
+			if delay > socketBackoffMax {
+				delay = socketBackoffMax
+			}
+			s.logger.WithError(err).WithField("delay", delay.String()).Error("socket mode connection failed, reconnecting")
+		} else {
+			failures = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+
+}
+
+// runSocketConnection opens a connection and reads from it until it drops. A nil error means Slack asked for the
+// connection to be replaced, which it does every few hours
+func (s *server) runSocketConnection(ctx context.Context) error {
+
+	url, err := s.openSocketURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to dial socket mode url")
+	}
+	defer conn.Close()
+
+	// Closing the connection is the only way to interrupt a blocked read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second*5))
+	})
+
+	for {
+		var envelope socketEnvelope
+		err := conn.ReadJSON(&envelope)
+		if err != nil {
+			return errors.Wrap(err, "failed to read from socket mode connection")
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+
+		if envelope.EnvelopeID != "" {
+			err = conn.WriteJSON(socketAck{EnvelopeID: envelope.EnvelopeID})
+			if err != nil {
+				return errors.Wrap(err, "failed to acknowledge socket mode envelope")
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			s.logger.Info("socket mode connection established")
+		case "disconnect":
+			s.logger.WithField("reason", envelope.Reason).Info("slack asked for the socket mode connection to be replaced")
+			return nil
+		default:
+			go s.dispatchSocketEnvelope(envelope)
+		}
+	}
+
+}
+
+// openSocketURL asks Slack for the url of a new Socket Mode connection
+func (s *server) openSocketURL(ctx context.Context) (string, error) {
+
+	uri := strings.TrimSuffix(s.config.SlackAPIURL, "/") + "/apps.connections.open"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build apps.connections.open request")
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.SlackAppToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to call apps.connections.open")
+	}
+	defer resp.Body.Close()
+
+	var open socketOpenResponse
+	err = json.NewDecoder(resp.Body).Decode(&open)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode apps.connections.open response")
+	}
+	if !open.OK {
+		return "", errors.Errorf("apps.connections.open failed: %s", open.Error)
+	}
+
+	return open.URL, nil
+
+}
+
+// dispatchSocketEnvelope hands the payload of an envelope to the same handlers the public endpoints use
+func (s *server) dispatchSocketEnvelope(envelope socketEnvelope) {
+
+	ctx := context.Background()
+	logger := s.logger.WithFields(logrus.Fields{
+		"envelope_id": envelope.EnvelopeID,
+		"type":        envelope.Type,
+	})
+
+	switch envelope.Type {
+	case "events_api":
+		event, err := slackevents.ParseEvent(envelope.Payload, slackevents.OptionNoVerifyToken())
+		if err != nil {
+			logger.WithError(err).Error("failed to parse socket mode event")
+			return
+		}
+		s.dispatchSlackEvent(ctx, event)
+	case "interactive":
+		var interaction slack.Interaction
+		err := json.Unmarshal(envelope.Payload, &interaction)
+		if err != nil {
+			logger.WithError(err).Error("failed to decode socket mode interaction")
+			return
+		}
+		s.slack.ProcessInteraction(ctx, &interaction)
+	case "slash_commands":
+		var command nslack.SlashCommand
+		err := json.Unmarshal(envelope.Payload, &command)
+		if err != nil {
+			logger.WithError(err).Error("failed to decode socket mode slash command")
+			return
+		}
+		s.slack.ProcessSlashCommand(ctx, command)
+	default:
+		logger.Warn("received socket mode envelope of unknown type")
+	}
+
+}
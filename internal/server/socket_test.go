@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eveisesi/eb2"
+	"github.com/gorilla/websocket"
+)
+
+const socketEventPayload = `{
+	"token": "verification-token",
+	"team_id": "T0D4M5N6B",
+	"api_app_id": "A0F7XDUAZ",
+	"type": "event_callback",
+	"event_id": "Ev013A2D4M5N",
+	"event_time": 1589461200,
+	"event": {
+		"type": "message",
+		"channel": "C0ESI1234",
+		"user": "U0C3RZL4Z",
+		"text": "!status",
+		"ts": "1589461200.001800"
+	}
+}`
+
+const socketCommandPayload = `{
+	"token": "verification-token",
+	"team_id": "T0D4M5N6B",
+	"channel_id": "C0ESI1234",
+	"user_id": "U0C3RZL4Z",
+	"command": "/esi",
+	"text": "status --public",
+	"response_url": "https://hooks.slack.com/commands/T0D4M5N6B/1114196540081/0tvQGXzNqS6b",
+	"trigger_id": "1114196540081.13135254150.6f1a9e4d7c0b9e3d2e2f3b7d1f2f6a9d"
+}`
+
+// socketScript is what the fake Slack sends over a connection. Every envelope with an id waits for its ack
+type socketScript []map[string]interface{}
+
+func TestRunSocketMode(t *testing.T) {
+
+	scripts := []socketScript{
+		{
+			{"type": "hello", "num_connections": 1},
+			{"type": "events_api", "envelope_id": "a1b2c3d4-events", "payload": json.RawMessage(socketEventPayload)},
+			{"type": "disconnect", "reason": "refresh_requested"},
+		},
+		{
+			{"type": "hello", "num_connections": 1},
+			{"type": "slash_commands", "envelope_id": "e5f6a7b8-command", "payload": json.RawMessage(socketCommandPayload)},
+		},
+	}
+
+	var opens int32
+	acks := make(chan string, 8)
+	upgrader := websocket.Upgrader{}
+
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps.connections.open":
+			if r.Header.Get("Authorization") != "Bearer xapp-test" {
+				_, _ = w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+				return
+			}
+			n := atomic.AddInt32(&opens, 1)
+			_, _ = fmt.Fprintf(w, `{"ok":true,"url":"ws%s/link/?connection=%d"}`, strings.TrimPrefix(api.URL, "http"), n)
+		case "/link/":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+
+			var n int
+			_, _ = fmt.Sscanf(r.URL.Query().Get("connection"), "%d", &n)
+			if n < 1 || n > len(scripts) {
+				return
+			}
+
+			for _, envelope := range scripts[n-1] {
+				err = conn.WriteJSON(envelope)
+				if err != nil {
+					return
+				}
+				if _, ok := envelope["envelope_id"]; !ok {
+					continue
+				}
+
+				var ack struct {
+					EnvelopeID string `json:"envelope_id"`
+				}
+				err = conn.ReadJSON(&ack)
+				if err != nil {
+					t.Errorf("expected %s to be acknowledged: %s", envelope["envelope_id"], err)
+					return
+				}
+				acks <- ack.EnvelopeID
+			}
+
+			// Hold the connection open until the bot closes it
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	fake := newFakeSlack()
+	s := &server{
+		config: &eb2.Config{SlackAppToken: "xapp-test", SlackAPIURL: api.URL + "/"},
+		logger: newTestLogger(),
+		slack:  fake,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.RunSocketMode(ctx) }()
+
+	fake.wait(t, 2)
+
+	for _, expected := range []string{"a1b2c3d4-events", "e5f6a7b8-command"} {
+		select {
+		case id := <-acks:
+			if id != expected {
+				t.Errorf("expected %s to be acknowledged, got %s", expected, id)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for %s to be acknowledged", expected)
+		}
+	}
+
+	if opened := atomic.LoadInt32(&opens); opened != 2 {
+		t.Errorf("expected a new connection to be opened after the disconnect, %d were opened", opened)
+	}
+
+	fake.mu.Lock()
+	if len(fake.events) != 1 || fake.events[0].Text != "!status" || fake.events[0].Channel != "C0ESI1234" {
+		t.Errorf("expected the message event to be dispatched, got %+v", fake.events)
+	}
+	if len(fake.commands) != 1 || fake.commands[0].Text != "status --public" || fake.commands[0].ResponseURL == "" {
+		t.Errorf("expected the slash command to be dispatched, got %+v", fake.commands)
+	}
+	fake.mu.Unlock()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected socket mode to stop cleanly, got %s", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("socket mode did not stop after the context was cancelled")
+	}
+
+}
+
+func TestSocketModeDropsSlackEndpoints(t *testing.T) {
+
+	for _, transport := range []string{eb2.SlackTransportHTTP, eb2.SlackTransportSocket} {
+		t.Run(transport, func(t *testing.T) {
+
+			s := &server{
+				config: &eb2.Config{SlackTransport: transport, SlackSigningSecret: "secret", GithubWebhookSecret: "secret"},
+				logger: newTestLogger(),
+				slack:  newFakeSlack(),
+			}
+			router := s.BuildRouter()
+
+			for _, path := range []string{"/slack", "/slack/interactive", "/slack/commands"} {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+
+				mounted := w.Code != http.StatusNotFound
+				if mounted != (transport == eb2.SlackTransportHTTP) {
+					t.Errorf("expected %s to be mounted only for the http transport, got %d", path, w.Code)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/github/webhook", strings.NewReader("{}")))
+			if w.Code == http.StatusNotFound {
+				t.Error("expected the github webhook to be mounted for every transport")
+			}
+
+		})
+	}
+
+}
@@ -1,10 +1,11 @@
 package slack
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
 
+	"github.com/eveisesi/eb2"
 	"github.com/eveisesi/eb2/pkg/tools"
 	"github.com/sirkon/go-format"
 	"github.com/sirupsen/logrus"
@@ -19,11 +20,97 @@ type HelpTextFunc func(Command) string
 type ExampleGen func(Command) string
 
 type Event struct {
+	ctx     context.Context
 	origin  *slackevents.MessageEvent
 	trigger string
 	args    []string
 	flags   map[string]string
 	meta    map[string]interface{}
+
+	// response is set when the event came in as a slash command
+	response *slashResponse
+}
+
+// Context returns the context of the command invocation. It is cancelled once the command has
+// returned or has run for longer than commandTimeout, whichever comes first
+func (e Event) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+
+	return e.ctx
+}
+
+// boolFlag reports whether a switch like --raw or --raw=1 was passed with the event
+func (e Event) boolFlag(name string) bool {
+	v, ok := e.flags[name]
+	if !ok {
+		return false
+	}
+
+	switch strings.ToLower(v) {
+	case "true", "1", "yes":
+		return true
+	}
+	return false
+}
+
+// threadTS returns the timestamp of the thread the event was posted in, if it was posted in one
+func (e Event) threadTS() string {
+	if e.origin == nil {
+		return ""
+	}
+
+	return e.origin.ThreadTimeStamp
+}
+
+// reply posts to the channel of the event, keeping the reply in the thread the event was posted in.
+// Passing --broadcast also sends a reply in a thread to the channel.
+// Slash commands are answered through their response url, only to whoever ran them unless --public is passed.
+// Once Slack would refuse further posts to the response url, the replies are sent through the Web API instead
+func (s *service) reply(event Event, options ...nslack.MsgOption) (string, string, error) {
+	if event.response != nil {
+		public := event.boolFlag("public")
+		if event.response.take() {
+			responseType := nslack.ResponseTypeEphemeral
+			if public {
+				responseType = nslack.ResponseTypeInChannel
+			}
+			return s.respond(event.response.url, responseType, options...)
+		}
+
+		// The response url is used up, the rest of the replies go through the Web API with the same visibility
+		if !public {
+			timestamp, err := s.goslack.PostEphemeral(event.origin.Channel, event.origin.User, options...)
+			return event.origin.Channel, timestamp, err
+		}
+		return s.goslack.PostMessage(event.origin.Channel, options...)
+	}
+
+	if ts := event.threadTS(); ts != "" {
+		options = append(options, nslack.MsgOptionTS(ts))
+		if event.boolFlag("broadcast") {
+			options = append(options, nslack.MsgOptionBroadcast())
+		}
+	}
+
+	return s.goslack.PostMessage(event.origin.Channel, options...)
+}
+
+// upload shares the file in the channel of the event, keeping it in the thread the event was posted in.
+// Slack has no way of broadcasting a file shared in a thread, so --broadcast is silently dropped for file replies.
+// Response urls can't carry files, slash commands are answered with the content as a code block instead
+func (s *service) upload(event Event, params nslack.FileUploadParameters) (*nslack.File, error) {
+	if event.response != nil {
+		text := fmt.Sprintf("%s\n```%s```", strings.TrimSpace(params.Title+" "+params.InitialComment), truncateRunes(params.Content, maxRespondedFile))
+		_, _, err := s.reply(event, nslack.MsgOptionText(text, false))
+		return nil, err
+	}
+
+	params.Channels = []string{event.origin.Channel}
+	params.ThreadTimestamp = event.threadTS()
+
+	return s.goslack.UploadFile(params)
 }
 
 type Flags map[string][]string
@@ -70,6 +157,7 @@ type Command struct {
 	Flags        Flags
 	Action       Action
 	HelpTextFunc HelpTextFunc
+	Interactions []InteractionHandler
 	triggers     []string
 	example      ExampleGen
 }
@@ -111,7 +199,7 @@ func (s *service) BuildCommands() []Category {
 						text := fmt.Sprintf("Current Version: %s", s.config.AppVersion)
 
 						s.logger.Info("Responding to request for help (ephemeral)")
-						channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(text, false))
+						channel, timestamp, err := s.reply(event, nslack.MsgOptionText(text, false))
 						if err != nil {
 							s.logger.WithError(err).Error("failed to respond to request for help (ephemeral).")
 							return
@@ -227,7 +315,7 @@ func (s *service) BuildCommands() []Category {
 							"example":     c.example(c),
 						})
 					},
-					triggers: []string{"id", "ids", "ranges"},
+					triggers: []string{"ranges"},
 					example: func(c Command) string {
 						return format.Formatm("${prefix} ${trigger}", format.Values{
 							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
@@ -352,6 +440,11 @@ func (s *service) BuildCommands() []Category {
 						return strInStrSlice(s, c.triggers)
 					},
 					triggers: []string{"new"},
+					// The issue forms are offered by new, bug, fr and incon alike but can only be registered once
+					Interactions: []InteractionHandler{
+						{Type: nslack.InteractionTypeInteractionMessage, ID: callbackFileIssue, Handle: s.openIssueForm},
+						{Type: InteractionTypeViewSubmission, ID: callbackIssueForm, Handle: s.fileIssue},
+					},
 					HelpTextFunc: func(c Command) string {
 						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
 							"trigger":     strings.Join(c.triggers, ", "),
@@ -430,6 +523,53 @@ func (s *service) BuildCommands() []Category {
 						})
 					},
 				},
+				Command{
+					Description: "Search esi-issues and sso-issues for existing issues before opening a new one. Narrow it down with --state=open, --label=bug or --repo=sso",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"state": searchStates,
+						"label": []string{},
+						"repo":  []string{"esi", "sso"},
+					},
+					Action:   s.makeIssueSearchMessage,
+					triggers: []string{"search"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} "market orders" --state=open`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Find issues on esi-issues that are similar to the one you are about to open",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Action:   s.makeDupesMessage,
+					triggers: []string{"dupes", "dupe", "similar"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} "structure market orders return 403"`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
 			},
 		},
 		Category{
@@ -462,6 +602,48 @@ func (s *service) BuildCommands() []Category {
 						})
 					},
 				},
+				Command{
+					Description: "Check how much of the ESI error limit the bot has left on every ESI host",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Action:   s.makeESIErrorLimitMessage,
+					triggers: []string{"errorlimit"},
+					example: func(c Command) string {
+						return format.Formatm("${prefix} ${trigger}", format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Check how much of the Github rate limit the bot has left",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Action:   s.makeGithubRateLimitMessage,
+					triggers: []string{"ghlimit", "ratelimit"},
+					example: func(c Command) string {
+						return format.Formatm("${prefix} ${trigger}", format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
 				Command{
 					Description: "Check the uptime and player count of the Eve Servers",
 					TriggerFunc: func(c Command, s string) bool {
@@ -511,7 +693,7 @@ func (s *service) BuildCommands() []Category {
 			Description: "Commands that allow you to make requests to supported external APIs including ESI",
 			Commands: []Command{
 				Command{
-					Description: "Use this command to easily call out to /universe/types/:id",
+					Description: "Use this command to easily call out to /universe/types/:id. Types can also be looked up by (partial) name, wrap names containing spaces in quotes. Add --raw for the full JSON response",
 					TriggerFunc: func(c Command, s string) bool {
 						return strInStrSlice(s, c.triggers)
 					},
@@ -522,6 +704,11 @@ func (s *service) BuildCommands() []Category {
 							"example":     c.example(c),
 						})
 					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"raw":        []string{"true"},
+					},
 					Action:   s.makeESITypeRequestMessage,
 					triggers: []string{"item", "item_id", "type", "type_id"},
 					example: func(c Command) string {
@@ -532,7 +719,236 @@ func (s *service) BuildCommands() []Category {
 					},
 				},
 				Command{
-					Description: "Any string begining with a `/` followed by a valid version number will trigger a request to ESI",
+					Description: "Resolve one or more ids to their names and categories using /universe/names",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeNameLookupMessage,
+					triggers: []string{"name", "names"},
+					example: func(c Command) string {
+						return format.Formatm("${prefix} ${trigger} 30000142 1000125", format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Resolve one or more names to their ids using /universe/ids. Wrap names containing spaces in quotes. Without any names this links to the id ranges docs",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeIDLookupMessage,
+					triggers: []string{"id", "ids"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} "Jita" "CCP Games"`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Price a type using the regional order books. Defaults to Jita, use --hub=amarr or --region=\"The Forge\" to look elsewhere",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"hub":        []string{"jita", "amarr", "dodixie", "rens", "hek"},
+						"region":     []string{},
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeMarketPriceMessage,
+					triggers: []string{"price", "prices", "market"},
+					example: func(c Command) string {
+						return format.Formatm("${prefix} ${trigger} Tritanium --hub=amarr", format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Show the security, location, sovereignty and recent activity of a solar system",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeSystemMessage,
+					triggers: []string{"system", "sys"},
+					example: func(c Command) string {
+						return format.Formatm("${prefix} ${trigger} Jita", format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Show the public information of a character, including their corporation history",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeCharacterMessage,
+					triggers: []string{"char", "character"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} CCP Falcon`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Show the public information of a corporation, including its alliance history",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeCorporationMessage,
+					triggers: []string{"corp", "corporation"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} C C P`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Show the public information of an alliance",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeAllianceMessage,
+					triggers: []string{"alliance"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} C C P Alliance`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Plan a route between two systems. Use --flag=secure or --flag=insecure to change the preference and --avoid=Tama,Rancer to avoid systems",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"flag":       routeFlags,
+						"avoid":      []string{},
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeRouteMessage,
+					triggers: []string{"route"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} Jita Amarr --flag=secure`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Look up a killmail by its id and hash, or by a link to the kill on zKillboard. Links to zKillboard posted anywhere else are looked up automatically",
+					TriggerFunc: func(c Command, s string) bool {
+						return strInStrSlice(s, c.triggers)
+					},
+					HelpTextFunc: func(c Command) string {
+						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
+							"trigger":     strings.Join(c.triggers, ", "),
+							"description": c.Description,
+							"example":     c.example(c),
+						})
+					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
+					Action:   s.makeKillmailMessage,
+					triggers: []string{"killmail", "km"},
+					example: func(c Command) string {
+						return format.Formatm(`${prefix} ${trigger} https://zkillboard.com/kill/81733283/`, format.Values{
+							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
+							"trigger": c.triggers[tools.UnsignedRandomIntWithMax(len(c.triggers)-1)],
+						})
+					},
+				},
+				Command{
+					Description: "Any string begining with a `/` followed by a valid version number will trigger a request to ESI. Add --server=serenity to send it to Serenity",
 					TriggerFunc: func(c Command, s string) bool {
 						return strings.HasPrefix(s, "/")
 					},
@@ -543,7 +959,14 @@ func (s *service) BuildCommands() []Category {
 							"example":     c.example(c),
 						})
 					},
+					Flags: map[string][]string{
+						"server":     []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+						"datasource": []string{eb2.ESI_TRANQUILITY, eb2.ESI_SERENITY},
+					},
 					Action: s.makeESIDynamicRequestMessage,
+					Interactions: []InteractionHandler{
+						{Type: nslack.InteractionTypeBlockActions, ID: actionRunESIRequest, Handle: s.runOfferedESIRequest},
+					},
 					example: func(c Command) string {
 						return format.Formatm("${prefix} ${trigger}", format.Values{
 							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
@@ -552,14 +975,15 @@ func (s *service) BuildCommands() []Category {
 					},
 				},
 				Command{
-					Description: "Any string begining with a `#` followed an integer will trigger a look up of that issue on Github",
+					Description: "Any string begining with a `#` followed an integer will trigger a look up of that issue on Github. Prefix it with sso or owner/repo to look in another repository, and list several to look them all up",
 					TriggerFunc: func(c Command, s string) bool {
-						re, _ := regexp.Compile("^#[0-9]+")
-						return re.Match([]byte(s))
+						// The trigger may be followed by punctuation, i.e. "see #123, #124."
+						_, ok := parseIssueRef(strings.TrimRight(s, ",."))
+						return ok
 					},
 					HelpTextFunc: func(c Command) string {
 						return format.Formatm("${trigger}\n\t${description} (i.e. ${example})\n", format.Values{
-							"trigger":     "#[0-9]",
+							"trigger":     "#[0-9], sso#[0-9], owner/repo#[0-9]",
 							"description": c.Description,
 							"example":     c.example(c),
 						})
@@ -568,7 +992,7 @@ func (s *service) BuildCommands() []Category {
 					example: func(c Command) string {
 						return format.Formatm("${prefix} ${trigger}", format.Values{
 							"prefix":  s.config.SlackPrefixes[tools.UnsignedRandomIntWithMax(len(s.config.SlackPrefixes)-1)],
-							"trigger": "#123",
+							"trigger": "#123 sso#12",
 						})
 					},
 				},
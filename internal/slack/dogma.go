@@ -0,0 +1,355 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/eveisesi/eb2"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// dogmaUnit describes how the value of an attribute with the unit should be displayed.
+// ESI exposes the unit_id of an attribute but not the units themselves, these are taken from the SDE
+type dogmaUnit struct {
+	symbol  string
+	convert func(float64) float64
+}
+
+var dogmaUnits = map[int32]dogmaUnit{
+	1:   {symbol: "m"},
+	2:   {symbol: "kg"},
+	3:   {symbol: "sec"},
+	9:   {symbol: "m³"},
+	10:  {symbol: "m/sec"},
+	11:  {symbol: "m/sec²"},
+	101: {symbol: "sec", convert: func(v float64) float64 { return v / 1000 }},
+	104: {symbol: "x"},
+	105: {symbol: "%"},
+	106: {symbol: "tf"},
+	107: {symbol: "MW"},
+	108: {symbol: "%", convert: func(v float64) float64 { return (1 - v) * 100 }},
+	109: {symbol: "%", convert: func(v float64) float64 { return (v - 1) * 100 }},
+	111: {symbol: "%", convert: func(v float64) float64 { return (1 - v) * 100 }},
+	112: {symbol: "rad/sec"},
+	113: {symbol: "HP"},
+	114: {symbol: "GJ"},
+	121: {symbol: "%"},
+	123: {symbol: "sec"},
+	124: {symbol: "%"},
+	125: {symbol: "N"},
+	126: {symbol: "ly"},
+	127: {symbol: "%", convert: func(v float64) float64 { return v * 100 }},
+	128: {symbol: "Mbit/sec"},
+	129: {symbol: "hours"},
+	133: {symbol: "ISK"},
+	134: {symbol: "m³/hour"},
+	135: {symbol: "AU"},
+	136: {symbol: "slot"},
+	138: {symbol: "units"},
+	139: {symbol: "+"},
+	140: {symbol: "level"},
+	141: {symbol: "hardpoints"},
+}
+
+// dogmaReferenceUnits are the units of attributes whose value is the id of a group, type or attribute
+var dogmaReferenceUnits = map[int32]bool{
+	115: true,
+	116: true,
+	119: true,
+}
+
+// formatDogmaValue renders the value of an attribute in its unit, i.e. 1.25 with unit 109 becomes "25 %"
+func formatDogmaValue(value float64, unitID int32) string {
+
+	if dogmaReferenceUnits[unitID] {
+		return strconv.FormatInt(int64(value), 10)
+	}
+
+	unit, ok := dogmaUnits[unitID]
+	if !ok {
+		return humanize.CommafWithDigits(value, 2)
+	}
+
+	if unit.convert != nil {
+		value = unit.convert(value)
+	}
+
+	return humanize.CommafWithDigits(value, 2) + " " + unit.symbol
+
+}
+
+const (
+	// dogmaTTL is how long the attributes and effects in the dogma cache are trusted before they are fetched again
+	dogmaTTL = time.Hour * 24
+
+	// dogmaWorkers caps the number of concurrent requests made while warming the dogma cache
+	dogmaWorkers = 10
+)
+
+// dogmaCache holds the metadata of every dogma attribute and effect on Tranquility so that type
+// lookups don't need to call out to ESI for each of them. The cache is persisted to disk. Once it
+// is older than dogmaTTL every attribute and effect is fetched again, otherwise only the missing ones are
+type dogmaCache struct {
+	mu         sync.RWMutex
+	path       string
+	attributes map[int32]*GetDogmaAttributesAttributeIdOk
+	effects    map[int32]*GetDogmaEffectsEffectIdOk
+	refreshed  time.Time
+	warming    bool
+}
+
+// dogmaFile is the on disk representation of the dogma cache
+type dogmaFile struct {
+	Refreshed  time.Time                          `json:"refreshed"`
+	Attributes []*GetDogmaAttributesAttributeIdOk `json:"attributes"`
+	Effects    []*GetDogmaEffectsEffectIdOk       `json:"effects"`
+}
+
+func newDogmaCache(path string) *dogmaCache {
+	return &dogmaCache{
+		path:       path,
+		attributes: make(map[int32]*GetDogmaAttributesAttributeIdOk),
+		effects:    make(map[int32]*GetDogmaEffectsEffectIdOk),
+	}
+}
+
+func (d *dogmaCache) attribute(id int32) (*GetDogmaAttributesAttributeIdOk, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	attr, ok := d.attributes[id]
+	return attr, ok
+}
+
+func (d *dogmaCache) effect(id int32) (*GetDogmaEffectsEffectIdOk, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	effect, ok := d.effects[id]
+	return effect, ok
+}
+
+func (d *dogmaCache) storeAttribute(attr *GetDogmaAttributesAttributeIdOk) {
+	d.mu.Lock()
+	d.attributes[attr.AttributeId] = attr
+	d.mu.Unlock()
+}
+
+func (d *dogmaCache) storeEffect(effect *GetDogmaEffectsEffectIdOk) {
+	d.mu.Lock()
+	d.effects[effect.EffectId] = effect
+	d.mu.Unlock()
+}
+
+// prune drops the attributes and effects that are no longer listed by ESI
+func (d *dogmaCache) prune(attributeIDs, effectIDs []int32) {
+	attributes := make(map[int32]bool, len(attributeIDs))
+	for _, id := range attributeIDs {
+		attributes[id] = true
+	}
+	effects := make(map[int32]bool, len(effectIDs))
+	for _, id := range effectIDs {
+		effects[id] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id := range d.attributes {
+		if !attributes[id] {
+			delete(d.attributes, id)
+		}
+	}
+	for id := range d.effects {
+		if !effects[id] {
+			delete(d.effects, id)
+		}
+	}
+}
+
+func (d *dogmaCache) stale() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return !d.warming && time.Since(d.refreshed) > dogmaTTL
+}
+
+// load reads the cache from disk. A missing file is not an error, the cache is simply cold
+func (d *dogmaCache) load() error {
+
+	data, err := ioutil.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read dogma cache")
+	}
+
+	var file dogmaFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode dogma cache")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, attr := range file.Attributes {
+		d.attributes[attr.AttributeId] = attr
+	}
+	for _, effect := range file.Effects {
+		d.effects[effect.EffectId] = effect
+	}
+	d.refreshed = file.Refreshed
+
+	return nil
+
+}
+
+// save writes the cache to a temporary file and moves it into place so that
+// a crash mid write never leaves a truncated cache behind
+func (d *dogmaCache) save() error {
+
+	d.mu.RLock()
+	file := dogmaFile{
+		Refreshed:  d.refreshed,
+		Attributes: make([]*GetDogmaAttributesAttributeIdOk, 0, len(d.attributes)),
+		Effects:    make([]*GetDogmaEffectsEffectIdOk, 0, len(d.effects)),
+	}
+	for _, attr := range d.attributes {
+		file.Attributes = append(file.Attributes, attr)
+	}
+	for _, effect := range d.effects {
+		file.Effects = append(file.Effects, effect)
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(file.Attributes, func(i, j int) bool { return file.Attributes[i].AttributeId < file.Attributes[j].AttributeId })
+	sort.Slice(file.Effects, func(i, j int) bool { return file.Effects[i].EffectId < file.Effects[j].EffectId })
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode dogma cache")
+	}
+
+	tmp := d.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write dogma cache")
+	}
+
+	return errors.Wrap(os.Rename(tmp, d.path), "failed to move dogma cache into place")
+
+}
+
+// refreshDogma fetches the dogma attributes and effects the cache does not know about yet and persists the cache.
+// When the cache has gone stale every attribute and effect is fetched again so that changes to them are picked up
+func (s *service) refreshDogma() {
+
+	s.dogma.mu.Lock()
+	if s.dogma.warming {
+		s.dogma.mu.Unlock()
+		return
+	}
+	s.dogma.warming = true
+	full := time.Since(s.dogma.refreshed) > dogmaTTL
+	s.dogma.mu.Unlock()
+
+	defer func() {
+		s.dogma.mu.Lock()
+		s.dogma.warming = false
+		s.dogma.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+	start := time.Now()
+
+	var attributeIDs, effectIDs []int32
+	if !s.getESIJSON(ctx, esiURL(eb2.ESI_TRANQUILITY, "/v1/dogma/attributes/", nil), &attributeIDs) {
+		s.logger.Error("failed to fetch the list of dogma attributes")
+		return
+	}
+	if !s.getESIJSON(ctx, esiURL(eb2.ESI_TRANQUILITY, "/v1/dogma/effects/", nil), &effectIDs) {
+		s.logger.Error("failed to fetch the list of dogma effects")
+		return
+	}
+
+	missingAttributes := make([]int32, 0)
+	for _, id := range attributeIDs {
+		if _, ok := s.dogma.attribute(id); full || !ok {
+			missingAttributes = append(missingAttributes, id)
+		}
+	}
+
+	missingEffects := make([]int32, 0)
+	for _, id := range effectIDs {
+		if _, ok := s.dogma.effect(id); full || !ok {
+			missingEffects = append(missingEffects, id)
+		}
+	}
+
+	pool := newWorkerPool(ctx, dogmaWorkers)
+	for _, id := range missingAttributes {
+		id := id
+		pool.Go(func(ctx context.Context) { s.fetchDogmaAttribute(ctx, eb2.ESI_TRANQUILITY, id) })
+	}
+	for _, id := range missingEffects {
+		id := id
+		pool.Go(func(ctx context.Context) { s.fetchDogmaEffect(ctx, eb2.ESI_TRANQUILITY, id) })
+	}
+	_ = pool.Wait()
+
+	s.dogma.prune(attributeIDs, effectIDs)
+
+	s.dogma.mu.Lock()
+	s.dogma.refreshed = time.Now()
+	s.dogma.mu.Unlock()
+
+	err := s.dogma.save()
+	if err != nil {
+		s.logger.WithError(err).Error("failed to persist dogma cache")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"attributes": len(missingAttributes),
+		"effects":    len(missingEffects),
+		"full":       full,
+		"took":       time.Since(start).String(),
+	}).Info("refreshed dogma cache")
+
+}
+
+// fetchDogmaAttribute fetches a single attribute from ESI. Attributes of Tranquility are stored in the dogma cache
+func (s *service) fetchDogmaAttribute(ctx context.Context, server string, id int32) (*GetDogmaAttributesAttributeIdOk, bool) {
+	var attr GetDogmaAttributesAttributeIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/dogma/attributes/%d/", id), nil), &attr) {
+		return nil, false
+	}
+
+	if server == eb2.ESI_TRANQUILITY {
+		s.dogma.storeAttribute(&attr)
+	}
+	return &attr, true
+}
+
+// fetchDogmaEffect fetches a single effect from ESI. Effects of Tranquility are stored in the dogma cache
+func (s *service) fetchDogmaEffect(ctx context.Context, server string, id int32) (*GetDogmaEffectsEffectIdOk, bool) {
+	var effect GetDogmaEffectsEffectIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/dogma/effects/%d/", id), nil), &effect) {
+		return nil, false
+	}
+
+	if server == eb2.ESI_TRANQUILITY {
+		s.dogma.storeEffect(&effect)
+	}
+	return &effect, true
+}
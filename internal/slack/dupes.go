@@ -0,0 +1,326 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/eveisesi/eb2"
+	"github.com/google/go-github/v29/github"
+	"github.com/sirupsen/logrus"
+
+	nslack "github.com/nlopes/slack"
+)
+
+const (
+	// issueIndexTTL is how long the issue index is used before the issues updated since are fetched
+	issueIndexTTL = time.Hour * 6
+
+	// issueIndexRebuildTTL is how often the issue index is built from scratch. Issues that were deleted
+	// or transferred to another repository are never listed as updated, so only a rebuild drops them
+	issueIndexRebuildTTL = time.Hour * 24
+
+	// maxDupeResults caps the number of similar issues listed in reply to a dupes request
+	maxDupeResults = 5
+
+	// bm25K1 and bm25B are the usual BM25 parameters, controlling term frequency saturation and length normalisation
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// titleBoost is how many times the terms of a title are counted, titles say more about an issue than bodies do
+	titleBoost = 3
+)
+
+// stopwords are left out of the index, they match nearly every issue
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true, "by": true,
+	"for": true, "from": true, "has": true, "have": true, "i": true, "if": true, "in": true, "is": true, "it": true,
+	"its": true, "not": true, "of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "were": true, "when": true, "which": true, "while": true, "with": true, "you": true,
+}
+
+// issueDoc is a single issue in the index along with the frequency of its terms
+type issueDoc struct {
+	number int
+	title  string
+	state  string
+	url    string
+	terms  map[string]int
+	length int
+}
+
+// issueIndex is a BM25 index over the titles and bodies of the issues on esi-issues. The issues are kept
+// around so that refreshes only need to fetch the issues that were updated since the last one
+type issueIndex struct {
+	mu       sync.RWMutex
+	docs     map[int]*issueDoc
+	df       map[string]int
+	avgLen   float64
+	built    time.Time
+	rebuilt  time.Time
+	building bool
+}
+
+func (i *issueIndex) stale() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return !i.building && time.Since(i.built) > issueIndexTTL
+}
+
+func (i *issueIndex) ready() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.docs) > 0
+}
+
+// merge adds the issues to the index, replacing older copies of the same issue, and recomputes the statistics.
+// A full merge holds every issue of the repository and replaces the index, dropping the issues that are gone
+func (i *issueIndex) merge(docs []*issueDoc, built time.Time, full bool) {
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.docs == nil || full {
+		i.docs = make(map[int]*issueDoc, len(docs))
+		i.rebuilt = built
+	}
+	for _, doc := range docs {
+		i.docs[doc.number] = doc
+	}
+
+	i.df = make(map[string]int)
+	total := 0
+	for _, doc := range i.docs {
+		total += doc.length
+		for term := range doc.terms {
+			i.df[term]++
+		}
+	}
+
+	i.avgLen = 0
+	if len(i.docs) > 0 {
+		i.avgLen = float64(total) / float64(len(i.docs))
+	}
+	i.built = built
+
+}
+
+type dupeMatch struct {
+	doc   *issueDoc
+	score float64
+}
+
+// search ranks the issues against the text using BM25
+func (i *issueIndex) search(text string) []dupeMatch {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	query := make(map[string]bool)
+	for _, term := range tokenize(text) {
+		query[term] = true
+	}
+
+	n := float64(len(i.docs))
+	var matches []dupeMatch
+	for _, doc := range i.docs {
+		score := 0.0
+		for term := range query {
+			tf := float64(doc.terms[term])
+			if tf == 0 {
+				continue
+			}
+
+			df := float64(i.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/i.avgLen))
+		}
+
+		if score > 0 {
+			matches = append(matches, dupeMatch{doc: doc, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].score != matches[b].score {
+			return matches[a].score > matches[b].score
+		}
+		return matches[a].doc.number > matches[b].doc.number
+	})
+
+	return matches
+
+}
+
+// tokenize lower cases the text and splits it into terms, dropping stopwords and single characters
+func tokenize(text string) []string {
+
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if len(field) < 2 || stopwords[field] {
+			continue
+		}
+		// A crude stemmer that folds plurals onto their singular, i.e. orders and order
+		if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			field = strings.TrimSuffix(field, "s")
+		}
+		terms = append(terms, field)
+	}
+
+	return terms
+
+}
+
+func newIssueDoc(issue *github.Issue) *issueDoc {
+
+	doc := &issueDoc{
+		number: issue.GetNumber(),
+		title:  issue.GetTitle(),
+		state:  issue.GetState(),
+		url:    issue.GetHTMLURL(),
+		terms:  make(map[string]int),
+	}
+
+	for _, term := range tokenize(issue.GetTitle()) {
+		doc.terms[term] += titleBoost
+		doc.length += titleBoost
+	}
+
+	for _, term := range tokenize(issue.GetBody()) {
+		doc.terms[term]++
+		doc.length++
+	}
+
+	return doc
+
+}
+
+// refreshIssueIndex fetches the issues on esi-issues that were updated since the index was last built.
+// The first refresh and every refresh after issueIndexRebuildTTL fetch every issue and rebuild the index
+func (s *service) refreshIssueIndex() {
+
+	if s.github.throttled(githubRateCore) {
+		s.logger.Info("github rate limit is nearly exhausted, skipping issue index refresh")
+		return
+	}
+
+	s.issues.mu.Lock()
+	if s.issues.building {
+		s.issues.mu.Unlock()
+		return
+	}
+	s.issues.building = true
+	since := s.issues.built
+	full := since.IsZero() || time.Since(s.issues.rebuilt) > issueIndexRebuildTTL
+	s.issues.mu.Unlock()
+
+	if full {
+		since = time.Time{}
+	}
+
+	defer func() {
+		s.issues.mu.Lock()
+		s.issues.building = false
+		s.issues.mu.Unlock()
+	}()
+
+	owner, repo := issueRepoAliases["esi"][0], issueRepoAliases["esi"][1]
+
+	start := time.Now()
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var docs []*issueDoc
+	for {
+		issues, resp, err := s.gogithub.Issues.ListByRepo(context.Background(), owner, repo, opts)
+		if err != nil {
+			s.logger.WithError(err).Error("failed to build issue index")
+			return
+		}
+
+		for _, issue := range issues {
+			if issue.IsPullRequest() {
+				continue
+			}
+			docs = append(docs, newIssueDoc(issue))
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	s.issues.merge(docs, start, full)
+
+	s.logger.WithFields(logrus.Fields{
+		"issues": len(docs),
+		"took":   time.Since(start).String(),
+		"full":   full,
+	}).Info("refreshed issue index")
+
+}
+
+func (s *service) makeDupesMessage(event Event) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(`You need to describe the issue, i.e. "market orders are missing for structures"`, false))
+		return
+	}
+
+	if !s.issues.ready() {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("I'm still indexing esi-issues, try again in a minute", false))
+		return
+	}
+
+	description := strings.Join(event.args, " ")
+	matches := s.issues.search(description)
+	if len(matches) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("I couldn't find anything like that on %s. `%s new` explains how to open an issue", eb2.ESI_ISSUES, s.config.SlackPrefixes[0]), false))
+		return
+	}
+
+	if len(matches) > maxDupeResults {
+		matches = matches[:maxDupeResults]
+	}
+
+	// Scores are shown relative to the best match, the raw BM25 scores don't mean much to people
+	best := matches[0].score
+	lines := make([]string, 0, len(matches))
+	for _, match := range matches {
+		lines = append(lines, fmt.Sprintf("<%s|#%d> %s (%s, %.0f%%)", match.doc.url, match.doc.number, match.doc.title, match.doc.state, match.score/best*100))
+	}
+
+	attachment := nslack.Attachment{
+		Color:    "#3AA3E3",
+		Title:    "These issues look similar, please check them before opening a new one",
+		Text:     strings.Join(lines, "\n"),
+		Fallback: strings.Join(lines, "\n"),
+	}
+
+	s.logger.Info("Responding to request for duplicate issues")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for duplicate issues.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for duplicate issues")
+
+}
@@ -0,0 +1,46 @@
+package slack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+func TestIssueIndexRebuildDropsMissingIssues(t *testing.T) {
+
+	issue := func(number int, title string) *issueDoc {
+		return newIssueDoc(&github.Issue{Number: github.Int(number), Title: github.String(title), State: github.String("open")})
+	}
+
+	index := &issueIndex{}
+	index.merge([]*issueDoc{
+		issue(1201, "Market orders are missing for structures"),
+		issue(1202, "Skill queue returns finished skills"),
+	}, time.Now(), true)
+
+	// An update only touches the issues that were fetched
+	index.merge([]*issueDoc{issue(1203, "Structure market orders return a 500")}, time.Now(), false)
+	if len(index.docs) != 3 {
+		t.Fatalf("expected an update to keep the indexed issues, got %d", len(index.docs))
+	}
+
+	// 1201 was transferred away, a rebuild no longer lists it
+	index.merge([]*issueDoc{
+		issue(1202, "Skill queue returns finished skills"),
+		issue(1203, "Structure market orders return a 500"),
+	}, time.Now(), true)
+
+	if _, ok := index.docs[1201]; ok || len(index.docs) != 2 {
+		t.Errorf("expected the rebuild to drop the transferred issue, got %d issues", len(index.docs))
+	}
+	for _, match := range index.search("market orders missing") {
+		if match.doc.number == 1201 {
+			t.Error("expected the transferred issue not to be suggested as a duplicate")
+		}
+	}
+	if index.df["missing"] != 0 {
+		t.Errorf("expected the terms of the transferred issue to be dropped, got a document frequency of %d", index.df["missing"])
+	}
+
+}
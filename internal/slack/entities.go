@@ -0,0 +1,361 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	nslack "github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+)
+
+// maxHistoryEntries caps the number of corporation or alliance history records listed on a card
+const maxHistoryEntries = 5
+
+type GetCharactersCharacterIdOk struct {
+	AllianceId     int32     `json:"alliance_id,omitempty"`
+	Birthday       time.Time `json:"birthday,omitempty"`
+	CorporationId  int32     `json:"corporation_id,omitempty"`
+	FactionId      int32     `json:"faction_id,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	SecurityStatus float64   `json:"security_status,omitempty"`
+	Title          string    `json:"title,omitempty"`
+}
+
+type GetCharactersCharacterIdCorporationhistory200Ok struct {
+	CorporationId int32     `json:"corporation_id,omitempty"`
+	IsDeleted     bool      `json:"is_deleted,omitempty"`
+	RecordId      int32     `json:"record_id,omitempty"`
+	StartDate     time.Time `json:"start_date,omitempty"`
+}
+
+type GetCorporationsCorporationIdOk struct {
+	AllianceId  int32     `json:"alliance_id,omitempty"`
+	CeoId       int32     `json:"ceo_id,omitempty"`
+	DateFounded time.Time `json:"date_founded,omitempty"`
+	FactionId   int32     `json:"faction_id,omitempty"`
+	MemberCount int32     `json:"member_count,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	TaxRate     float32   `json:"tax_rate,omitempty"`
+	Ticker      string    `json:"ticker,omitempty"`
+	Url         string    `json:"url,omitempty"`
+	WarEligible bool      `json:"war_eligible,omitempty"`
+}
+
+type GetCorporationsCorporationIdAlliancehistory200Ok struct {
+	AllianceId int32     `json:"alliance_id,omitempty"`
+	IsDeleted  bool      `json:"is_deleted,omitempty"`
+	RecordId   int32     `json:"record_id,omitempty"`
+	StartDate  time.Time `json:"start_date,omitempty"`
+}
+
+type GetAlliancesAllianceIdOk struct {
+	CreatorCorporationId  int32     `json:"creator_corporation_id,omitempty"`
+	CreatorId             int32     `json:"creator_id,omitempty"`
+	DateFounded           time.Time `json:"date_founded,omitempty"`
+	ExecutorCorporationId int32     `json:"executor_corporation_id,omitempty"`
+	FactionId             int32     `json:"faction_id,omitempty"`
+	Name                  string    `json:"name,omitempty"`
+	Ticker                string    `json:"ticker,omitempty"`
+}
+
+// historyEntry is a single membership record of a character or corporation, newest first
+type historyEntry struct {
+	id        int64
+	startDate time.Time
+	deleted   bool
+}
+
+func (s *service) makeCharacterMessage(event Event) {
+
+	ctx := event.Context()
+
+	server, id, ok := s.entityFromEvent(event, "character")
+	if !ok {
+		return
+	}
+
+	var character GetCharactersCharacterIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v5/characters/%d/", id), nil), &character) {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Unable to fetch character %d from esi", id), false))
+		return
+	}
+
+	var records []*GetCharactersCharacterIdCorporationhistory200Ok
+	s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v2/characters/%d/corporationhistory/", id), nil), &records)
+
+	history := make([]historyEntry, 0, len(records))
+	for _, record := range records {
+		history = append(history, historyEntry{id: int64(record.CorporationId), startDate: record.StartDate, deleted: record.IsDeleted})
+	}
+
+	ids := []int64{int64(character.CorporationId), int64(character.AllianceId)}
+	names := s.nameMap(ctx, server, append(ids, historyIDs(history)...)...)
+
+	fields := []nslack.AttachmentField{
+		{Title: "Corporation", Value: nameOrID(names, int64(character.CorporationId)), Short: true},
+		{Title: "Alliance", Value: nameOrID(names, int64(character.AllianceId)), Short: true},
+		{Title: "Birthday", Value: formatEntityDate(character.Birthday), Short: true},
+		{Title: "Security Status", Value: fmt.Sprintf("%.2f", character.SecurityStatus), Short: true},
+	}
+	if character.Title != "" {
+		fields = append(fields, nslack.AttachmentField{Title: "Title", Value: htmlTags.ReplaceAllString(character.Title, ""), Short: true})
+	}
+	fields = append(fields, nslack.AttachmentField{Title: "Corporation History", Value: renderHistory(history, names, "corporation")})
+
+	attachment := nslack.Attachment{
+		Color:     "#3AA3E3",
+		Title:     fmt.Sprintf("%s (%d)", character.Name, id),
+		TitleLink: fmt.Sprintf("https://evewho.com/character/%d", id),
+		ThumbURL:  fmt.Sprintf("%s/characters/%d/portrait?size=128", imageServer, id),
+		Fields:    fields,
+		Fallback:  fmt.Sprintf("%s (%d), %s", character.Name, id, nameOrID(names, int64(character.CorporationId))),
+	}
+
+	s.postEntityCard(event, "character", attachment)
+
+}
+
+func (s *service) makeCorporationMessage(event Event) {
+
+	ctx := event.Context()
+
+	server, id, ok := s.entityFromEvent(event, "corporation")
+	if !ok {
+		return
+	}
+
+	var corporation GetCorporationsCorporationIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v5/corporations/%d/", id), nil), &corporation) {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Unable to fetch corporation %d from esi", id), false))
+		return
+	}
+
+	var records []*GetCorporationsCorporationIdAlliancehistory200Ok
+	s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v3/corporations/%d/alliancehistory/", id), nil), &records)
+
+	history := make([]historyEntry, 0, len(records))
+	for _, record := range records {
+		history = append(history, historyEntry{id: int64(record.AllianceId), startDate: record.StartDate, deleted: record.IsDeleted})
+	}
+
+	ids := []int64{int64(corporation.CeoId), int64(corporation.AllianceId), int64(corporation.FactionId)}
+	names := s.nameMap(ctx, server, append(ids, historyIDs(history)...)...)
+
+	fields := []nslack.AttachmentField{
+		{Title: "Ticker", Value: fmt.Sprintf("[%s]", corporation.Ticker), Short: true},
+		{Title: "Members", Value: humanize.Comma(int64(corporation.MemberCount)), Short: true},
+		{Title: "CEO", Value: nameOrID(names, int64(corporation.CeoId)), Short: true},
+		{Title: "Alliance", Value: nameOrID(names, int64(corporation.AllianceId)), Short: true},
+		{Title: "Founded", Value: formatEntityDate(corporation.DateFounded), Short: true},
+		{Title: "Tax Rate", Value: fmt.Sprintf("%.0f%%", corporation.TaxRate*100), Short: true},
+	}
+	if corporation.FactionId != 0 {
+		fields = append(fields, nslack.AttachmentField{Title: "Faction", Value: nameOrID(names, int64(corporation.FactionId)), Short: true})
+	}
+	fields = append(fields, nslack.AttachmentField{Title: "Alliance History", Value: renderHistory(history, names, "alliance")})
+
+	attachment := nslack.Attachment{
+		Color:     "#3AA3E3",
+		Title:     fmt.Sprintf("%s [%s] (%d)", corporation.Name, corporation.Ticker, id),
+		TitleLink: fmt.Sprintf("https://evewho.com/corporation/%d", id),
+		ThumbURL:  fmt.Sprintf("%s/corporations/%d/logo?size=128", imageServer, id),
+		Fields:    fields,
+		Fallback:  fmt.Sprintf("%s [%s] (%d), %d members", corporation.Name, corporation.Ticker, id, corporation.MemberCount),
+	}
+
+	s.postEntityCard(event, "corporation", attachment)
+
+}
+
+func (s *service) makeAllianceMessage(event Event) {
+
+	ctx := event.Context()
+
+	server, id, ok := s.entityFromEvent(event, "alliance")
+	if !ok {
+		return
+	}
+
+	var alliance GetAlliancesAllianceIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v4/alliances/%d/", id), nil), &alliance) {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Unable to fetch alliance %d from esi", id), false))
+		return
+	}
+
+	// The member count of an alliance is the sum of the member counts of its corporations,
+	// which would take a call per corporation. The number of corporations is shown instead
+	var corporations []int32
+	members := "-"
+	if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v2/alliances/%d/corporations/", id), nil), &corporations) {
+		members = humanize.Comma(int64(len(corporations)))
+	}
+
+	names := s.nameMap(ctx, server, int64(alliance.ExecutorCorporationId), int64(alliance.CreatorId), int64(alliance.CreatorCorporationId), int64(alliance.FactionId))
+
+	fields := []nslack.AttachmentField{
+		{Title: "Ticker", Value: fmt.Sprintf("[%s]", alliance.Ticker), Short: true},
+		{Title: "Corporations", Value: members, Short: true},
+		{Title: "Executor", Value: nameOrID(names, int64(alliance.ExecutorCorporationId)), Short: true},
+		{Title: "Founded", Value: formatEntityDate(alliance.DateFounded), Short: true},
+		{Title: "Creator", Value: nameOrID(names, int64(alliance.CreatorId)), Short: true},
+		{Title: "Creator Corporation", Value: nameOrID(names, int64(alliance.CreatorCorporationId)), Short: true},
+	}
+	if alliance.FactionId != 0 {
+		fields = append(fields, nslack.AttachmentField{Title: "Faction", Value: nameOrID(names, int64(alliance.FactionId)), Short: true})
+	}
+
+	attachment := nslack.Attachment{
+		Color:     "#3AA3E3",
+		Title:     fmt.Sprintf("%s [%s] (%d)", alliance.Name, alliance.Ticker, id),
+		TitleLink: fmt.Sprintf("https://evewho.com/alliance/%d", id),
+		ThumbURL:  fmt.Sprintf("%s/alliances/%d/logo?size=128", imageServer, id),
+		Fields:    fields,
+		Fallback:  fmt.Sprintf("%s [%s] (%d)", alliance.Name, alliance.Ticker, id),
+	}
+
+	s.postEntityCard(event, "alliance", attachment)
+
+}
+
+// entityFromEvent resolves the arguments of the event to the id of an entity in the category.
+// Any error is posted to the channel, in which case false is returned
+func (s *service) entityFromEvent(event Event, category string) (string, int64, bool) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("You need to supply the name or id of a %s", category), false))
+		return "", 0, false
+	}
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return "", 0, false
+	}
+
+	id, _, err := s.resolveID(event.Context(), server, strings.Join(event.args, " "), category)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return "", 0, false
+	}
+
+	return server, id, true
+
+}
+
+func (s *service) postEntityCard(event Event, category string, attachment nslack.Attachment) {
+
+	s.logger.Info("Responding to request for " + category)
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for " + category + ".")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for " + category)
+
+}
+
+// nameMap resolves the ids to names in a single call, skipping zero ids. An empty map is returned
+// when the lookup fails so that the card can fall back to showing the ids
+func (s *service) nameMap(ctx context.Context, server string, ids ...int64) map[int64]string {
+
+	names := make(map[int64]string)
+
+	seen := make(map[int64]bool)
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	if len(unique) == 0 || len(unique) > maxNamesPerRequest {
+		return names
+	}
+
+	resolved, err := s.resolveNames(ctx, server, unique)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to resolve names for card")
+		return names
+	}
+
+	for _, name := range resolved {
+		names[name.ID] = name.Name
+	}
+
+	return names
+
+}
+
+func nameOrID(names map[int64]string, id int64) string {
+	if id == 0 {
+		return "-"
+	}
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+func formatEntityDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s)", t.Format("2006-01-02"), humanize.Time(t))
+}
+
+// historyIDs returns the ids of the most recent history entries, which are the ones rendered on the card
+func historyIDs(history []historyEntry) []int64 {
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].startDate.After(history[j].startDate)
+	})
+
+	ids := make([]int64, 0, maxHistoryEntries)
+	for i, entry := range history {
+		if i == maxHistoryEntries {
+			break
+		}
+		ids = append(ids, entry.id)
+	}
+
+	return ids
+
+}
+
+// renderHistory lists the most recent history entries. It expects history to have been sorted by historyIDs
+func renderHistory(history []historyEntry, names map[int64]string, category string) string {
+
+	if len(history) == 0 {
+		return "-"
+	}
+
+	lines := make([]string, 0, maxHistoryEntries+1)
+	for i, entry := range history {
+		if i == maxHistoryEntries {
+			lines = append(lines, fmt.Sprintf("_and %d more_", len(history)-maxHistoryEntries))
+			break
+		}
+
+		name := nameOrID(names, entry.id)
+		if entry.id == 0 {
+			name = fmt.Sprintf("No %s", category)
+		}
+		if entry.deleted {
+			name += " (closed)"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s", entry.startDate.Format("2006-01-02"), name))
+	}
+
+	return strings.Join(lines, "\n")
+
+}
@@ -0,0 +1,349 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	nslack "github.com/nlopes/slack"
+)
+
+const (
+	// maxFeedPages caps the number of pages of repository events read in a single poll. Github
+	// only serves the last 300 events of a repository, which is 10 pages of 30
+	maxFeedPages = 10
+
+	// maxFeedAttachments caps the number of events posted in a single message
+	maxFeedAttachments = 10
+)
+
+// feedRepos are the repositories whose issue activity is posted to the feed channel
+var feedRepos = []string{"esi", "sso"}
+
+// staffAssociations are the author associations of comments left by CCP staff. CCP staff are
+// members of the organisations that own the issue repositories
+var staffAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// feedState remembers the newest event posted for every repository so that nothing is posted
+// twice, not even across restarts. It is persisted to disk after every poll
+type feedState struct {
+	mu      sync.Mutex
+	path    string
+	polling bool
+	polled  time.Time
+
+	LastEventID map[string]int64 `json:"last_event_id"`
+}
+
+func newFeedState(path string) *feedState {
+	return &feedState{
+		path:        path,
+		LastEventID: make(map[string]int64),
+	}
+}
+
+func (f *feedState) due(interval time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return !f.polling && time.Since(f.polled) >= interval
+}
+
+func (f *feedState) last(repo string) (int64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id, ok := f.LastEventID[repo]
+	return id, ok
+}
+
+func (f *feedState) setLast(repo string, id int64) {
+	f.mu.Lock()
+	f.LastEventID[repo] = id
+	f.mu.Unlock()
+}
+
+// load reads the state from disk. A missing file is not an error, the feed simply starts from the current events
+func (f *feedState) load() error {
+
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read github feed state")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode github feed state")
+	}
+	if f.LastEventID == nil {
+		f.LastEventID = make(map[string]int64)
+	}
+
+	return nil
+
+}
+
+// save writes the state to a temporary file and moves it into place so that
+// a crash mid write never leaves a truncated state behind
+func (f *feedState) save() error {
+
+	f.mu.Lock()
+	data, err := json.Marshal(f)
+	f.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode github feed state")
+	}
+
+	tmp := f.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write github feed state")
+	}
+
+	return errors.Wrap(os.Rename(tmp, f.path), "failed to move github feed state into place")
+
+}
+
+// pollIssueActivity posts the issue activity on the feed repositories since the last poll to the feed channel
+func (s *service) pollIssueActivity() {
+
+	if s.github.throttled(githubRateCore) {
+		s.logger.Info("github rate limit is nearly exhausted, skipping issue activity poll")
+		return
+	}
+
+	s.feed.mu.Lock()
+	if s.feed.polling {
+		s.feed.mu.Unlock()
+		return
+	}
+	s.feed.polling = true
+	s.feed.mu.Unlock()
+
+	defer func() {
+		s.feed.mu.Lock()
+		s.feed.polling = false
+		s.feed.polled = time.Now()
+		s.feed.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	for _, alias := range feedRepos {
+		repo := issueRepoAliases[alias]
+		name := repo[0] + "/" + repo[1]
+
+		err := s.pollRepoActivity(ctx, repo[0], repo[1])
+		if err != nil {
+			s.logger.WithError(err).WithField("repo", name).Error("failed to poll issue activity")
+		}
+	}
+
+	err := s.feed.save()
+	if err != nil {
+		s.logger.WithError(err).Error("failed to save github feed state")
+	}
+
+}
+
+func (s *service) pollRepoActivity(ctx context.Context, owner, repo string) error {
+
+	name := owner + "/" + repo
+	last, known := s.feed.last(name)
+
+	// Events come newest first, so paging stops as soon as an event that was already posted shows up
+	var events []*github.Event
+	var newest int64
+	opts := &github.ListOptions{PerPage: 30}
+Pages:
+	for page := 0; page < maxFeedPages; page++ {
+		batch, resp, err := s.gogithub.Activity.ListRepositoryEvents(ctx, owner, repo, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range batch {
+			id, err := strconv.ParseInt(event.GetID(), 10, 64)
+			if err != nil {
+				continue
+			}
+			if id > newest {
+				newest = id
+			}
+			if id <= last {
+				break Pages
+			}
+			events = append(events, event)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if newest == 0 {
+		return nil
+	}
+
+	// Without any state the feed would repost everything Github still remembers, so the first poll only takes note of where things are
+	if !known {
+		s.feed.setLast(name, newest)
+		s.logger.WithField("repo", name).Info("github feed has no state yet, starting from the current events")
+		return nil
+	}
+
+	// ids holds the id of the event each attachment was rendered from, oldest first
+	var attachments []nslack.Attachment
+	var ids []int64
+	for i := len(events) - 1; i >= 0; i-- {
+		attachment, ok := issueEventAttachment(name, events[i])
+		if ok {
+			id, _ := strconv.ParseInt(events[i].GetID(), 10, 64)
+			attachments = append(attachments, attachment)
+			ids = append(ids, id)
+		}
+	}
+
+	// The state is saved after every chunk so that a failure halfway through doesn't repost the chunks that made it
+	for len(attachments) > 0 {
+		n := len(attachments)
+		if n > maxFeedAttachments {
+			n = maxFeedAttachments
+		}
+
+		err := s.postFeedAttachments(attachments[:n])
+		if err != nil {
+			return err
+		}
+
+		s.feed.setLast(name, ids[n-1])
+		err = s.feed.save()
+		if err != nil {
+			s.logger.WithError(err).Error("failed to save github feed state")
+		}
+
+		attachments, ids = attachments[n:], ids[n:]
+	}
+
+	s.feed.setLast(name, newest)
+
+	return nil
+
+}
+
+func (s *service) postFeedAttachments(attachments []nslack.Attachment) error {
+
+	s.logger.Info("Posting issue activity")
+	channel, timestamp, err := s.goslack.PostMessage(s.config.GithubFeedChannel, nslack.MsgOptionAttachments(attachments...))
+	if err != nil {
+		return errors.Wrap(err, "failed to post issue activity")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully posted issue activity")
+
+	return nil
+
+}
+
+// issueEventAttachment renders a repository event as an attachment. Only new issues, closures, label
+// changes and comments by CCP staff are rendered, false is returned for everything else
+func issueEventAttachment(repo string, event *github.Event) (nslack.Attachment, bool) {
+
+	payload, err := event.ParsePayload()
+	if err != nil {
+		return nslack.Attachment{}, false
+	}
+
+	switch p := payload.(type) {
+	case *github.IssuesEvent:
+		return issueActivityAttachment(repo, p.GetAction(), p.Issue, event.Actor, p.Label, nil)
+	case *github.IssueCommentEvent:
+		return issueActivityAttachment(repo, p.GetAction(), p.Issue, event.Actor, nil, p.Comment)
+	}
+
+	return nslack.Attachment{}, false
+
+}
+
+// issueActivityAttachment renders activity on an issue. It is shared by the poller and the webhook, which
+// receive the same issues and issue_comment payloads
+func issueActivityAttachment(repo, action string, issue *github.Issue, actor *github.User, label *github.Label, comment *github.IssueComment) (nslack.Attachment, bool) {
+
+	if issue == nil || issue.IsPullRequest() {
+		return nslack.Attachment{}, false
+	}
+
+	attachment := nslack.Attachment{
+		AuthorName: actor.GetLogin(),
+		AuthorLink: actor.GetHTMLURL(),
+		AuthorIcon: actor.GetAvatarURL(),
+		Title:      fmt.Sprintf("%s#%d %s", repo, issue.GetNumber(), issue.GetTitle()),
+		TitleLink:  issue.GetHTMLURL(),
+	}
+
+	switch {
+	case comment != nil:
+		if action != "created" || !strInStrSlice(comment.GetAuthorAssociation(), staffAssociations) {
+			return nslack.Attachment{}, false
+		}
+		attachment.Color = "#3AA3E3"
+		attachment.Pretext = "New comment by CCP"
+		attachment.TitleLink = comment.GetHTMLURL()
+		attachment.Text = truncateRunes(comment.GetBody(), maxCardDescription)
+	case action == "opened":
+		attachment.Color = "#2cbe4e"
+		attachment.Pretext = "New issue"
+		attachment.Text = truncateRunes(issue.GetBody(), maxCardDescription)
+	case action == "closed":
+		attachment.Color = "#cb2431"
+		attachment.Pretext = "Issue closed"
+	case action == "reopened":
+		attachment.Color = "#2cbe4e"
+		attachment.Pretext = "Issue reopened"
+	case action == "labeled" && label != nil:
+		attachment.Color = "#" + strings.TrimPrefix(label.GetColor(), "#")
+		attachment.Pretext = fmt.Sprintf("Label %s added", label.GetName())
+	case action == "unlabeled" && label != nil:
+		attachment.Color = "#6a737d"
+		attachment.Pretext = fmt.Sprintf("Label %s removed", label.GetName())
+	default:
+		return nslack.Attachment{}, false
+	}
+
+	attachment.Fallback = fmt.Sprintf("%s: %s", attachment.Pretext, attachment.Title)
+
+	return attachment, true
+
+}
+
+// truncateRunes shortens the text to at most max runes, marking that it was cut off
+func truncateRunes(text string, max int) string {
+	text = strings.TrimSpace(text)
+
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+
+	return strings.TrimSpace(string(runes[:max])) + "…"
+}
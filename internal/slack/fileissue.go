@@ -0,0 +1,262 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/sirupsen/logrus"
+
+	nslack "github.com/nlopes/slack"
+)
+
+const (
+	// callbackFileIssue is the callback id of the issue attachments whose buttons open an issue form
+	callbackFileIssue = "file_issue"
+
+	// callbackIssueForm is the callback id of the modal the issue is filled in with
+	callbackIssueForm = "issue_form"
+
+	// maxIssueRoute caps the length of the route carried from the command into the form, the
+	// value of a button is limited to 2000 characters and a text input to 150
+	maxIssueRoute = 150
+)
+
+// issueFormField is a single input of an issue form. Fields are rendered as a section of the issue body,
+// headed by their label, except for the title which becomes the title of the issue
+type issueFormField struct {
+	name        string
+	label       string
+	placeholder string
+	textarea    bool
+	optional    bool
+	code        bool
+}
+
+// issueForm mirrors one of the issue templates on esi-issues
+type issueForm struct {
+	title  string
+	fields []issueFormField
+}
+
+var issueTitleField = issueFormField{name: "title", label: "Title", placeholder: "A short summary of the issue"}
+
+var issueRouteField = issueFormField{name: "route", label: "Route", placeholder: "GET /v4/characters/{character_id}/", code: true}
+
+var issueRequestIDField = issueFormField{name: "request_id", label: "Request ID", placeholder: "The X-Esi-Request-Id header of the response", optional: true, code: true}
+
+// issueForms are keyed by the kinds of issue makeIssues offers
+var issueForms = map[string]issueForm{
+	"bug": {
+		title: "Report A Bug",
+		fields: []issueFormField{
+			issueTitleField,
+			issueRouteField,
+			{name: "request", label: "Request", placeholder: "The parameters, headers and body of the request", textarea: true},
+			{name: "expected", label: "Expected Response", placeholder: "What ESI should have responded with", textarea: true},
+			{name: "actual", label: "Actual Response", placeholder: "What ESI responded with instead", textarea: true},
+			issueRequestIDField,
+		},
+	},
+	"feature": {
+		title: "Request A Feature",
+		fields: []issueFormField{
+			issueTitleField,
+			{name: "route", label: "Route", placeholder: "The route to change, if any", optional: true, code: true},
+			{name: "feature", label: "Feature", placeholder: "What should be added or changed", textarea: true},
+			{name: "use_case", label: "Use Case", placeholder: "What it makes possible and why it is needed", textarea: true},
+		},
+	},
+	"inconsistency": {
+		title: "Report An Inconsistency",
+		fields: []issueFormField{
+			issueTitleField,
+			issueRouteField,
+			{name: "request", label: "Request", placeholder: "The parameters, headers and body of the request", textarea: true, optional: true},
+			{name: "expected", label: "Expected Response", placeholder: "How the other routes return it", textarea: true},
+			{name: "actual", label: "Actual Response", placeholder: "How this route returns it", textarea: true},
+			issueRequestIDField,
+		},
+	},
+}
+
+// withIssueForm adds a button that opens the issue form of the kind to a copy of the attachment. The button
+// is only offered when a Github token is configured, without one the bot can't file issues
+func (s *service) withIssueForm(attachment nslack.Attachment, kind, route string) nslack.Attachment {
+
+	if s.config.GithubToken == "" {
+		return attachment
+	}
+
+	if len(route) > maxIssueRoute {
+		route = route[:maxIssueRoute]
+	}
+
+	attachment.CallbackID = callbackFileIssue
+	attachment.Actions = append(append([]nslack.AttachmentAction{}, attachment.Actions...), nslack.AttachmentAction{
+		Name:  callbackFileIssue,
+		Type:  "button",
+		Text:  "File It From Slack",
+		Value: strings.TrimSpace(kind + " " + route),
+	})
+
+	return attachment
+
+}
+
+// issueFormMetadata is carried through the modal in its private metadata. Submissions of a modal don't say
+// which channel it was opened from, so the thread the issue is posted to has to be remembered here
+type issueFormMetadata struct {
+	Kind     string `json:"kind"`
+	Channel  string `json:"channel"`
+	ThreadTS string `json:"thread_ts"`
+}
+
+// openIssueForm opens the issue form for the button that was clicked as a modal
+func (s *service) openIssueForm(callback Interaction) {
+
+	if len(callback.ActionCallback.AttachmentActions) == 0 {
+		return
+	}
+
+	parts := strings.SplitN(callback.ActionCallback.AttachmentActions[0].Value, " ", 2)
+	form, ok := issueForms[parts[0]]
+	if !ok {
+		s.logger.WithField("value", callback.ActionCallback.AttachmentActions[0].Value).Error("received issue form button with an invalid value")
+		return
+	}
+
+	values := map[string]string{}
+	if len(parts) == 2 {
+		values["route"] = parts[1]
+	}
+
+	ts := callback.OriginalMessage.ThreadTimestamp
+	if ts == "" {
+		ts = callback.MessageTs
+	}
+
+	metadata, err := json.Marshal(issueFormMetadata{Kind: parts[0], Channel: callback.Channel.ID, ThreadTS: ts})
+	if err != nil {
+		s.logger.WithError(err).Error("failed to encode issue form metadata")
+		return
+	}
+
+	blocks := make([]interface{}, 0, len(form.fields))
+	for _, field := range form.fields {
+		element := plainTextInput{
+			Type:         "plain_text_input",
+			ActionID:     field.name,
+			Placeholder:  nslack.NewTextBlockObject(nslack.PlainTextType, field.placeholder, false, false),
+			InitialValue: values[field.name],
+			Multiline:    field.textarea,
+		}
+		blocks = append(blocks, inputBlock{
+			Type:     "input",
+			BlockID:  field.name,
+			Label:    nslack.NewTextBlockObject(nslack.PlainTextType, field.label, false, false),
+			Element:  element,
+			Optional: field.optional,
+		})
+	}
+
+	err = s.openView(callback.Context(), callback.TriggerID, modalView{
+		Type:            "modal",
+		CallbackID:      callbackIssueForm,
+		PrivateMetadata: string(metadata),
+		Title:           nslack.NewTextBlockObject(nslack.PlainTextType, form.title, false, false),
+		Submit:          nslack.NewTextBlockObject(nslack.PlainTextType, "File", false, false),
+		Close:           nslack.NewTextBlockObject(nslack.PlainTextType, "Cancel", false, false),
+		Blocks:          blocks,
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("failed to open issue form")
+	}
+
+}
+
+// fileIssue creates the issue that was filled in on esi-issues and posts a link to it in the thread the form was opened from
+func (s *service) fileIssue(callback Interaction) {
+
+	var metadata issueFormMetadata
+	err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata)
+	form, ok := issueForms[metadata.Kind]
+	if err != nil || !ok {
+		s.logger.WithField("metadata", callback.View.PrivateMetadata).Error("received issue form with invalid metadata")
+		return
+	}
+
+	// Every input sits in a block of its own, both named after the field
+	submission := make(map[string]string, len(form.fields))
+	for _, field := range form.fields {
+		submission[field.name] = callback.View.State.Values[field.name][field.name].Value
+	}
+
+	channel, ts := metadata.Channel, metadata.ThreadTS
+	body := renderIssueBody(form, submission, callback.User.Name)
+
+	owner, repo := issueRepoAliases["esi"][0], issueRepoAliases["esi"][1]
+	issue, _, err := s.gogithub.Issues.Create(callback.Context(), owner, repo, &github.IssueRequest{
+		Title: github.String(strings.TrimSpace(submission["title"])),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("failed to file issue")
+
+		msg := fmt.Sprintf("unable to file the issue: %s", err)
+		if limitMsg, ok := githubLimitMessage(err); ok {
+			msg = limitMsg
+		}
+
+		// Hand the issue back so that what was filled in isn't lost
+		text := fmt.Sprintf("<@%s> %s. This is what you filled in, you can open the issue on https://github.com/%s/%s yourself\n```%s```", callback.User.ID, msg, owner, repo, body)
+		_, _, _ = s.goslack.PostMessage(channel, nslack.MsgOptionText(text, false), nslack.MsgOptionTS(ts))
+		return
+	}
+
+	text := fmt.Sprintf("<@%s> filed <%s|%s/%s#%d> %s", callback.User.ID, issue.GetHTMLURL(), owner, repo, issue.GetNumber(), issue.GetTitle())
+
+	s.logger.Info("Responding to issue form")
+	channel, timestamp, err := s.goslack.PostMessage(channel, nslack.MsgOptionText(text, false), nslack.MsgOptionTS(ts))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to issue form.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to issue form")
+
+}
+
+// renderIssueBody lays out the submitted form the way the issue templates on esi-issues do, one section per field
+func renderIssueBody(form issueForm, submission map[string]string, user string) string {
+
+	var b strings.Builder
+	for _, field := range form.fields {
+		if field.name == issueTitleField.name {
+			continue
+		}
+
+		value := strings.TrimSpace(submission[field.name])
+		if value == "" {
+			continue
+		}
+
+		fmt.Fprintf(&b, "### %s\n\n", field.label)
+		switch {
+		case field.code && !strings.Contains(value, "\n"):
+			fmt.Fprintf(&b, "`%s`\n\n", value)
+		case field.code:
+			fmt.Fprintf(&b, "```\n%s\n```\n\n", value)
+		default:
+			fmt.Fprintf(&b, "%s\n\n", value)
+		}
+	}
+
+	fmt.Fprintf(&b, "---\n_Filed from Slack by %s_\n", user)
+
+	return b.String()
+
+}
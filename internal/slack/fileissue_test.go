@@ -0,0 +1,195 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/eveisesi/eb2"
+	"github.com/google/go-github/v29/github"
+)
+
+// issueFormSubmission is a view_submission of the bug form as Slack posts it to the interactivity endpoint
+const issueFormSubmission = `{
+	"type": "view_submission",
+	"team": {"id": "T0D4M5N6B", "domain": "tweetfleet"},
+	"user": {"id": "U0C3RZL4Z", "username": "capsuleer.dev", "name": "capsuleer.dev", "team_id": "T0D4M5N6B"},
+	"api_app_id": "A0F7XDUAZ",
+	"token": "verification-token",
+	"trigger_id": "1114196540081.13135254150.6f1a9e4d7c0b9e3d2e2f3b7d1f2f6a9d",
+	"view": {
+		"id": "V012ZJ3RFA1",
+		"team_id": "T0D4M5N6B",
+		"type": "modal",
+		"callback_id": "issue_form",
+		"private_metadata": "{\"kind\":\"bug\",\"channel\":\"C0ESI1234\",\"thread_ts\":\"1589461200.001800\"}",
+		"state": {
+			"values": {
+				"title": {"title": {"type": "plain_text_input", "value": "  Finished skills are returned by the skill queue  "}},
+				"route": {"route": {"type": "plain_text_input", "value": "GET /v4/characters/{character_id}/skillqueue/"}},
+				"request": {"request": {"type": "plain_text_input", "value": "Authenticated as a character whose queue finished while offline"}},
+				"expected": {"expected": {"type": "plain_text_input", "value": "Only skills that are training or queued"}},
+				"actual": {"actual": {"type": "plain_text_input", "value": "[\n  {\"skill_id\": 3436, \"finished_level\": 5}\n]"}},
+				"request_id": {"request_id": {"type": "plain_text_input", "value": null}}
+			}
+		}
+	}
+}`
+
+func TestFileIssueFromModal(t *testing.T) {
+
+	var created github.IssueRequest
+	gh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/esi/esi-issues/issues" {
+			t.Errorf("unexpected github request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&created)
+		if err != nil {
+			t.Error(err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"number":1205,"title":"Finished skills are returned by the skill queue","html_url":"https://github.com/esi/esi-issues/issues/1205"}`))
+	}))
+	defer gh.Close()
+
+	api := newSlackRecorder()
+	defer api.Close()
+
+	config := &eb2.Config{GithubToken: "token", GithubAPIURL: gh.URL + "/", SlackAPIURL: api.URL + "/"}
+	gogithub, transport := newGithubClient(newTestLogger(), config.GithubToken, 0)
+	gogithub.BaseURL, _ = url.Parse(config.GithubAPIURL)
+
+	s := &service{
+		logger:   newTestLogger(),
+		config:   config,
+		goslack:  api.client(),
+		gogithub: gogithub,
+		github:   transport,
+	}
+	s.interactions = s.buildInteractions(s.flattenCommands(s.BuildCommands()))
+
+	var interaction Interaction
+	err := json.Unmarshal([]byte(issueFormSubmission), &interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.ProcessInteraction(context.Background(), &interaction)
+
+	if created.GetTitle() != "Finished skills are returned by the skill queue" {
+		t.Errorf("unexpected issue title %q", created.GetTitle())
+	}
+
+	body := "### Route\n\n" +
+		"`GET /v4/characters/{character_id}/skillqueue/`\n\n" +
+		"### Request\n\n" +
+		"Authenticated as a character whose queue finished while offline\n\n" +
+		"### Expected Response\n\n" +
+		"Only skills that are training or queued\n\n" +
+		"### Actual Response\n\n" +
+		"[\n  {\"skill_id\": 3436, \"finished_level\": 5}\n]\n\n" +
+		"---\n_Filed from Slack by capsuleer.dev_\n"
+	if created.GetBody() != body {
+		t.Errorf("unexpected issue body\n got: %q\nwant: %q", created.GetBody(), body)
+	}
+
+	calls := api.recorded()
+	if len(calls) != 1 || calls[0].method != "chat.postMessage" {
+		t.Fatalf("expected the issue to be posted to slack once, got %+v", calls)
+	}
+	if channel, ts := calls[0].form.Get("channel"), calls[0].form.Get("thread_ts"); channel != "C0ESI1234" || ts != "1589461200.001800" {
+		t.Errorf("expected the issue to be posted to the thread the form was opened from, got %s %s", channel, ts)
+	}
+	if text := calls[0].form.Get("text"); !strings.Contains(text, "<https://github.com/esi/esi-issues/issues/1205|esi/esi-issues#1205>") {
+		t.Errorf("expected a link to the issue, got %q", text)
+	}
+
+}
+
+func TestOpenIssueForm(t *testing.T) {
+
+	api := newSlackRecorder()
+	defer api.Close()
+
+	s := &service{
+		logger:  newTestLogger(),
+		config:  &eb2.Config{SlackAPIURL: api.URL + "/"},
+		goslack: api.client(),
+	}
+
+	var interaction Interaction
+	err := json.Unmarshal([]byte(`{
+		"type": "interactive_message",
+		"callback_id": "file_issue",
+		"trigger_id": "1114196540081.13135254150.6f1a9e4d7c0b9e3d2e2f3b7d1f2f6a9d",
+		"channel": {"id": "C0ESI1234", "name": "esi"},
+		"user": {"id": "U0C3RZL4Z", "name": "capsuleer.dev"},
+		"message_ts": "1589461300.002000",
+		"original_message": {"type": "message", "ts": "1589461300.002000", "thread_ts": "1589461200.001800"},
+		"actions": [{"name": "file_issue", "type": "button", "value": "bug GET /v4/characters/{character_id}/skillqueue/"}]
+	}`), &interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.openIssueForm(interaction)
+
+	calls := api.recorded()
+	if len(calls) != 1 || calls[0].method != "views.open" {
+		t.Fatalf("expected views.open to be called once, got %+v", calls)
+	}
+
+	var request struct {
+		TriggerID string `json:"trigger_id"`
+		View      struct {
+			Type            string `json:"type"`
+			CallbackID      string `json:"callback_id"`
+			PrivateMetadata string `json:"private_metadata"`
+			Blocks          []struct {
+				BlockID string `json:"block_id"`
+				Element struct {
+					ActionID     string `json:"action_id"`
+					InitialValue string `json:"initial_value"`
+				} `json:"element"`
+			} `json:"blocks"`
+		} `json:"view"`
+	}
+	err = json.Unmarshal(calls[0].body, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.TriggerID != interaction.TriggerID || request.View.Type != "modal" || request.View.CallbackID != callbackIssueForm {
+		t.Errorf("unexpected views.open request %+v", request)
+	}
+
+	var metadata issueFormMetadata
+	err = json.Unmarshal([]byte(request.View.PrivateMetadata), &metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata != (issueFormMetadata{Kind: "bug", Channel: "C0ESI1234", ThreadTS: "1589461200.001800"}) {
+		t.Errorf("unexpected private metadata %+v", metadata)
+	}
+
+	if len(request.View.Blocks) != len(issueForms["bug"].fields) {
+		t.Fatalf("expected a block for every field of the bug form, got %d", len(request.View.Blocks))
+	}
+	for _, block := range request.View.Blocks {
+		if block.BlockID != block.Element.ActionID {
+			t.Errorf("expected block %s to hold an input of the same name, got %s", block.BlockID, block.Element.ActionID)
+		}
+		if block.BlockID == "route" && block.Element.InitialValue != "GET /v4/characters/{character_id}/skillqueue/" {
+			t.Errorf("expected the route to be filled in, got %q", block.Element.InitialValue)
+		}
+	}
+
+}
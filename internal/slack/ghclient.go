@@ -0,0 +1,255 @@
+package slack
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	headerGithubRateLimit     = "X-RateLimit-Limit"
+	headerGithubRateRemaining = "X-RateLimit-Remaining"
+	headerGithubRateReset     = "X-RateLimit-Reset"
+
+	// githubCacheTTL is how long a response is kept around to be revalidated with If-None-Match.
+	// Github does not count conditional requests answered with a 304 against the rate limit
+	githubCacheTTL = time.Hour
+
+	// githubRateCore and githubRateSearch are the rate limit categories Github keeps separate budgets for
+	githubRateCore   = "core"
+	githubRateSearch = "search"
+)
+
+// githubRate is the rate limit Github last reported for a category
+type githubRate struct {
+	Known     bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// githubState is a snapshot of the rate limits along with a few counters
+// describing how the client has behaved since startup
+type githubState struct {
+	Authenticated bool
+	Buffer        int
+	Rates         map[string]githubRate
+
+	Requests    uint64
+	Revalidated uint64
+}
+
+type githubCacheEntry struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// githubTransport authenticates requests to the Github API when a token is configured, revalidates
+// GET requests that were answered before with If-None-Match, and keeps track of the rate limits
+type githubTransport struct {
+	logger *logrus.Logger
+	token  string
+	buffer int
+	base   http.RoundTripper
+	cache  *cache.Cache
+
+	mu          sync.Mutex
+	rates       map[string]githubRate
+	requests    uint64
+	revalidated uint64
+}
+
+func newGithubClient(logger *logrus.Logger, token string, buffer int) (*github.Client, *githubTransport) {
+
+	transport := &githubTransport{
+		logger: logger,
+		token:  token,
+		buffer: buffer,
+		base:   http.DefaultTransport,
+		cache:  cache.New(githubCacheTTL, time.Minute*10),
+		rates:  make(map[string]githubRate),
+	}
+
+	return github.NewClient(&http.Client{Transport: transport, Timeout: time.Second * 30}), transport
+
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	req = req.Clone(req.Context())
+	if t.token != "" {
+		req.Header.Set("Authorization", "token "+t.token)
+	}
+
+	var key string
+	var entry *githubCacheEntry
+	if req.Method == http.MethodGet && req.Header.Get("If-None-Match") == "" {
+		key = req.URL.String()
+		if cached, found := t.cache.Get(key); found {
+			entry = cached.(*githubCacheEntry)
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.update(githubRateCategory(req.URL.Path), resp.Header)
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		resp.Body.Close()
+
+		t.mu.Lock()
+		t.revalidated++
+		t.mu.Unlock()
+
+		// The cached headers carry the pagination links, the rate limit has to come from the fresh response though
+		header := entry.header.Clone()
+		for _, h := range []string{headerGithubRateLimit, headerGithubRateRemaining, headerGithubRateReset} {
+			header.Set(h, resp.Header.Get(h))
+		}
+
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.body)),
+			ContentLength: int64(len(entry.body)),
+			Request:       req,
+		}, nil
+	case resp.StatusCode == http.StatusOK && key != "" && resp.Header.Get("Etag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		t.cache.Set(key, &githubCacheEntry{
+			etag:   resp.Header.Get("Etag"),
+			header: resp.Header.Clone(),
+			body:   body,
+		}, cache.DefaultExpiration)
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return resp, nil
+
+}
+
+func (t *githubTransport) update(category string, header http.Header) {
+
+	limit, errLimit := strconv.Atoi(header.Get(headerGithubRateLimit))
+	remaining, errRemaining := strconv.Atoi(header.Get(headerGithubRateRemaining))
+	reset, errReset := strconv.ParseInt(header.Get(headerGithubRateReset), 10, 64)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	if errLimit != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+
+	previous := t.rates[category]
+	t.rates[category] = githubRate{
+		Known:     true,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}
+
+	fields := logrus.Fields{
+		"category":  category,
+		"limit":     limit,
+		"remaining": remaining,
+		"reset":     time.Unix(reset, 0).Format(time.RFC3339),
+	}
+
+	// Only warn when crossing into the buffer so that a long crawl doesn't flood the logs
+	switch {
+	case remaining <= t.buffer && (!previous.Known || previous.Remaining > t.buffer):
+		t.logger.WithFields(fields).Warn("github rate limit is nearly exhausted, background jobs are paused until it resets")
+	default:
+		t.logger.WithFields(fields).Debug("github rate limit")
+	}
+
+}
+
+// throttled reports whether the budget of the category has dropped to the buffer. Background jobs
+// check this before they start so that the remaining requests are left to the commands
+func (t *githubTransport) throttled(category string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rate := t.rates[category]
+	return rate.Known && rate.Remaining <= t.buffer && time.Now().Before(rate.Reset)
+}
+
+func (t *githubTransport) state() githubState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rates := make(map[string]githubRate, len(t.rates))
+	for category, rate := range t.rates {
+		rates[category] = rate
+	}
+
+	return githubState{
+		Authenticated: t.token != "",
+		Buffer:        t.buffer,
+		Rates:         rates,
+		Requests:      t.requests,
+		Revalidated:   t.revalidated,
+	}
+}
+
+// githubRateCategory mirrors how Github splits its rate limits, searches have a budget of their own
+func githubRateCategory(path string) string {
+	if strings.HasPrefix(path, "/search/") {
+		return githubRateSearch
+	}
+	return githubRateCore
+}
+
+// githubLimitMessage turns the rate limit errors of the Github client into something that can be shown
+// to the user. false is returned when the error has nothing to do with rate limits
+func githubLimitMessage(err error) (string, bool) {
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		wait := time.Until(rateErr.Rate.Reset.Time).Round(time.Minute)
+		if wait < time.Minute {
+			wait = time.Minute
+		}
+		return fmt.Sprintf("I've used up my Github rate limit, try again in %s", wait), true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return fmt.Sprintf("Github asked me to slow down, try again in %s", abuseErr.RetryAfter.Round(time.Second)), true
+		}
+		return "Github asked me to slow down, try again in a few minutes", true
+	}
+
+	return "", false
+
+}
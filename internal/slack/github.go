@@ -2,62 +2,239 @@ package slack
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/sirkon/go-format"
+	"github.com/dustin/go-humanize"
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	nslack "github.com/nlopes/slack"
 )
 
+// maxIssueReferences caps the number of issues looked up for a single message
+const maxIssueReferences = 5
+
+// issueRefRe matches references to issues, i.e. #12, sso#12 or esi/esi-issues#12
+var issueRefRe = regexp.MustCompile(`^(?:([\w.-]+)/([\w.-]+)|([\w-]+))?#([0-9]+)$`)
+
+// issueRepoAliases are the short names that can be put in front of an issue number.
+// A reference without a short name is an issue on esi-issues
+var issueRepoAliases = map[string][2]string{
+	"":       {"esi", "esi-issues"},
+	"esi":    {"esi", "esi-issues"},
+	"issues": {"esi", "esi-issues"},
+	"sso":    {"ccpgames", "sso-issues"},
+	"bot":    {"eveisesi", "esi-bot-v2"},
+}
+
+// issueRef is a reference to an issue or pull request on Github
+type issueRef struct {
+	owner  string
+	repo   string
+	number int
+}
+
+func (r issueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.owner, r.repo, r.number)
+}
+
+// parseIssueRef parses a reference like #12, sso#12 or owner/repo#12
+func parseIssueRef(s string) (issueRef, bool) {
+
+	match := issueRefRe.FindStringSubmatch(s)
+	if match == nil {
+		return issueRef{}, false
+	}
+
+	number, err := strconv.Atoi(match[4])
+	if err != nil || number <= 0 {
+		return issueRef{}, false
+	}
+
+	if match[1] != "" {
+		return issueRef{owner: match[1], repo: match[2], number: number}, true
+	}
+
+	repo, ok := issueRepoAliases[strings.ToLower(match[3])]
+	if !ok {
+		return issueRef{}, false
+	}
+
+	return issueRef{owner: repo[0], repo: repo[1], number: number}, true
+
+}
+
 func (s *service) makeGHIssueMessage(event Event) {
-	if !strings.HasPrefix(event.trigger, "#") {
-		return
+
+	var refs []issueRef
+	var notes []string
+	seen := make(map[issueRef]bool)
+
+	for _, arg := range append([]string{event.trigger}, event.args...) {
+		ref, ok := parseIssueRef(strings.Trim(arg, ",."))
+		if !ok {
+			notes = append(notes, fmt.Sprintf("%s is not an issue I know how to look up", arg))
+			continue
+		}
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		if len(refs) == maxIssueReferences {
+			notes = append(notes, fmt.Sprintf("Only the first %d issues are looked up, skipping %s", maxIssueReferences, arg))
+			continue
+		}
+		refs = append(refs, ref)
 	}
 
-	event.trigger = strings.TrimPrefix(event.trigger, "#")
-	s.logger.Info(event.trigger)
+	attachments := make([]nslack.Attachment, 0, len(refs))
+	for _, ref := range refs {
+		attachment, err := s.buildIssueCard(event.Context(), ref)
+		if err != nil {
+			notes = append(notes, err.Error())
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
 
-	number, err := strconv.Atoi(event.trigger)
-	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
+	options := []nslack.MsgOption{nslack.MsgOptionText(strings.Join(notes, "\n"), false)}
+	if len(attachments) > 0 {
+		options = append(options, nslack.MsgOptionAttachments(attachments...))
 	}
 
-	issue, response, err := s.gogithub.Issues.Get(context.Background(), "esi", "esi-issues", number)
-	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
-	}
-	text := ""
-	// https://developer.github.com/v3/issues/#get-a-single-issue
-	switch response.StatusCode {
-	case http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
-		text = format.Formatm("${status}", format.Values{
-			"status": response.Status,
-		})
-	case http.StatusOK:
-		url := ""
-		if issue.HTMLURL != nil {
-			url = *issue.HTMLURL
-		}
-		text = format.Formatm("${status}\n\n${link}", format.Values{
-			"status": response.Status,
-			"link":   url,
-		})
-	}
-
-	s.logger.Info("Responding to a request for a gh issue link")
-	channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(text, false), nslack.MsgOptionPostMessageParameters(nslack.PostMessageParameters{
-		UnfurlLinks: true,
-	}))
+	s.logger.Info("Responding to a request for a gh issue")
+	channel, timestamp, err := s.reply(event, options...)
 	if err != nil {
-		s.logger.WithError(err).Error("failed to a request for a gh issue link.")
+		s.logger.WithError(err).Error("failed to respond to a request for a gh issue.")
 		return
 	}
 	s.logger.WithFields(logrus.Fields{
 		"channel":   channel,
 		"timestamp": timestamp,
-	}).Info("successfully responded to a request for a gh issue link")
+	}).Info("successfully responded to a request for a gh issue")
+
+}
+
+// buildIssueCard looks up the issue or pull request and renders it as an attachment. The returned
+// errors are meant to be shown to the user as they are
+func (s *service) buildIssueCard(ctx context.Context, ref issueRef) (nslack.Attachment, error) {
+
+	issue, _, err := s.gogithub.Issues.Get(ctx, ref.owner, ref.repo, ref.number)
+	if err != nil {
+		return nslack.Attachment{}, issueError(ref, err)
+	}
+
+	state, color := issue.GetState(), "#2cbe4e"
+	if state == "closed" {
+		color = "#cb2431"
+	}
+
+	kind := "Issue"
+	if issue.IsPullRequest() {
+		kind = "Pull Request"
+
+		pr, _, err := s.gogithub.PullRequests.Get(ctx, ref.owner, ref.repo, ref.number)
+		if err == nil {
+			switch {
+			case pr.GetMerged():
+				state, color = "merged", "#6f42c1"
+			case pr.GetDraft():
+				state, color = "draft", "#6a737d"
+			}
+		}
+	}
+
+	labels := make([]string, 0, len(issue.Labels))
+	for _, label := range issue.Labels {
+		labels = append(labels, label.GetName())
+	}
+
+	assignees := make([]string, 0, len(issue.Assignees))
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.GetLogin())
+	}
+
+	fields := []nslack.AttachmentField{
+		{Title: "State", Value: strings.Title(state), Short: true},
+		{Title: "Comments", Value: strconv.Itoa(issue.GetComments()), Short: true},
+		{Title: "Labels", Value: valueOrDash(strings.Join(labels, ", ")), Short: true},
+		{Title: "Assignees", Value: valueOrDash(strings.Join(assignees, ", ")), Short: true},
+	}
+
+	if !issue.IsPullRequest() {
+		fields = append(fields, nslack.AttachmentField{Title: "Linked Pull Requests", Value: valueOrDash(strings.Join(s.linkedPullRequests(ctx, ref), ", ")), Short: true})
+	}
+
+	fields = append(fields, nslack.AttachmentField{Title: "Last Updated", Value: humanize.Time(issue.GetUpdatedAt()), Short: true})
+
+	return nslack.Attachment{
+		Color:      color,
+		AuthorName: issue.GetUser().GetLogin(),
+		AuthorLink: issue.GetUser().GetHTMLURL(),
+		AuthorIcon: issue.GetUser().GetAvatarURL(),
+		Title:      fmt.Sprintf("#%d %s", issue.GetNumber(), issue.GetTitle()),
+		TitleLink:  issue.GetHTMLURL(),
+		Fields:     fields,
+		Footer:     fmt.Sprintf("%s %s in %s/%s", kind, strings.ToLower(state), ref.owner, ref.repo),
+		Fallback:   fmt.Sprintf("%s %s: %s (%s)", ref, issue.GetTitle(), state, issue.GetHTMLURL()),
+	}, nil
+
+}
+
+// linkedPullRequests returns the pull requests that reference the issue. Lookups that fail
+// leave the list empty rather than failing the card
+func (s *service) linkedPullRequests(ctx context.Context, ref issueRef) []string {
+
+	events, _, err := s.gogithub.Issues.ListIssueTimeline(ctx, ref.owner, ref.repo, ref.number, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		s.logger.WithError(err).WithField("issue", ref.String()).Error("failed to fetch issue timeline")
+		return nil
+	}
+
+	var linked []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.GetEvent() != "cross-referenced" || event.Source == nil || event.Source.Issue == nil {
+			continue
+		}
+
+		source := event.Source.Issue
+		if !source.IsPullRequest() || seen[source.GetHTMLURL()] {
+			continue
+		}
+		seen[source.GetHTMLURL()] = true
+
+		linked = append(linked, fmt.Sprintf("<%s|#%d>", source.GetHTMLURL(), source.GetNumber()))
+	}
+
+	return linked
+
+}
+
+// issueError turns an error from the Github API into something that can be shown to the user
+func issueError(ref issueRef, err error) error {
+
+	if msg, ok := githubLimitMessage(err); ok {
+		return errors.New(msg)
+	}
+
+	if e, ok := err.(*github.ErrorResponse); ok && e.Response != nil {
+		switch e.Response.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%s does not exist", ref)
+		case http.StatusGone:
+			return fmt.Errorf("%s has been deleted", ref)
+		case http.StatusMovedPermanently:
+			return fmt.Errorf("%s has been moved to another repository", ref)
+		}
+	}
+
+	return fmt.Errorf("unable to look up %s: %s", ref, err)
 
 }
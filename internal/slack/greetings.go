@@ -34,7 +34,7 @@ func (s *service) makeGreeting(event Event) {
 	}
 
 	s.logger.Info("Responding to greeting request")
-	channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(text, false))
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionText(text, false))
 	if err != nil {
 		s.logger.WithError(err).Error("failed to respond to request for help.")
 		return
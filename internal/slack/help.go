@@ -20,6 +20,11 @@ func (s *service) makeHelpMessage(event Event) {
 		}
 	}
 
+	// Slash commands are answered through their response url, which is only visible to whoever ran the command anyway
+	if event.response != nil {
+		public = true
+	}
+
 	catLen := len(s.commands)
 
 	for i, category := range s.commands {
@@ -36,6 +41,8 @@ func (s *service) makeHelpMessage(event Event) {
 		}
 
 	}
+	blob = append(blob, "\n\nCommands sent in a thread are answered in that thread, add --broadcast to send the answer to the channel as well. Answers posted as files stay in the thread")
+	blob = append(blob, "\nCommands sent as a slash command are only shown to you, add --public to post the answer to the channel")
 	text := strings.Join(blob, "")
 
 	if unknown, ok := event.meta["unknown"].(bool); ok {
@@ -48,7 +55,7 @@ func (s *service) makeHelpMessage(event Event) {
 	if public {
 
 		s.logger.Info("Responding to request for help")
-		channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(text, false))
+		channel, timestamp, err := s.reply(event, nslack.MsgOptionText(text, false))
 		if err != nil {
 			s.logger.WithError(err).Error("failed to respond to request for help.")
 			return
@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"context"
+
+	nslack "github.com/nlopes/slack"
+)
+
+// InteractionTypeShortcut is sent by Slack for global shortcuts. The slack package predates them so it is declared here
+const InteractionTypeShortcut = nslack.InteractionType("shortcut")
+
+type InteractionFunc func(Interaction)
+
+// InteractionHandler registers a handler for the buttons, menus, dialogs, modals and shortcuts a command
+// offers. ID is the action_id of block actions and the callback_id of everything else
+type InteractionHandler struct {
+	Type   nslack.InteractionType
+	ID     string
+	Handle InteractionFunc
+}
+
+// Interaction is the payload Slack posts to the interactivity endpoint. It adds the view of modals
+// to the callback the slack package knows how to decode
+type Interaction struct {
+	nslack.InteractionCallback
+	View *View `json:"view,omitempty"`
+
+	ctx    context.Context
+	action *nslack.BlockAction
+}
+
+// Context returns the context of the interaction. It is cancelled once the handler has
+// returned or has run for longer than commandTimeout, whichever comes first
+func (i Interaction) Context() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+
+	return i.ctx
+}
+
+// Action returns the block action being handled. It is nil for anything other than block actions
+func (i Interaction) Action() *nslack.BlockAction {
+	return i.action
+}
+
+type interactionKey struct {
+	kind nslack.InteractionType
+	id   string
+}
+
+// buildInteractions indexes the interaction handlers of the commands. Two commands registering
+// the same interaction is a programming error, so the bot refuses to start
+func (s *service) buildInteractions(commands []Command) map[interactionKey]InteractionFunc {
+
+	interactions := make(map[interactionKey]InteractionFunc)
+	for _, command := range commands {
+		for _, handler := range command.Interactions {
+			key := interactionKey{kind: handler.Type, id: handler.ID}
+			if _, ok := interactions[key]; ok {
+				s.logger.WithField("type", handler.Type).WithField("id", handler.ID).Fatal("interaction handler is registered twice")
+			}
+			interactions[key] = handler.Handle
+		}
+	}
+
+	return interactions
+
+}
+
+// ProcessInteraction hands the interaction to the handler the command that offered it registered.
+// Every action of a block_actions payload is handed over on its own
+func (s *service) ProcessInteraction(ctx context.Context, interaction *Interaction) {
+
+	switch interaction.Type {
+	case nslack.InteractionTypeBlockActions:
+		for _, action := range interaction.ActionCallback.BlockActions {
+			i := *interaction
+			i.action = action
+			s.dispatchInteraction(action.ActionID, i)
+		}
+	case InteractionTypeViewSubmission:
+		if interaction.View == nil {
+			s.logger.Warn("received view submission without a view")
+			return
+		}
+		s.dispatchInteraction(interaction.View.CallbackID, *interaction)
+	default:
+		s.dispatchInteraction(interaction.CallbackID, *interaction)
+	}
+
+}
+
+func (s *service) dispatchInteraction(id string, interaction Interaction) {
+
+	handle, ok := s.interactions[interactionKey{kind: interaction.Type, id: id}]
+	if !ok {
+		s.logger.WithField("type", interaction.Type).WithField("id", id).Warn("received interaction without a handler")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	interaction.ctx = ctx
+	handle(interaction)
+
+}
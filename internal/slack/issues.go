@@ -2,6 +2,7 @@ package slack
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/eveisesi/eb2"
 	nslack "github.com/nlopes/slack"
@@ -59,27 +60,33 @@ func (s *service) makeIssues(event Event) {
 
 	var attachments []nslack.Attachment
 
+	// A route given along with the command is filled in on the issue form, i.e. bug GET /v4/characters/{character_id}/
+	route := strings.Join(event.args, " ")
+	bug := s.withIssueForm(br, "bug", route)
+	feature := s.withIssueForm(fr, "feature", route)
+	inconsistency := s.withIssueForm(incon, "inconsistency", route)
+
 	switch event.trigger {
 	case "bug", "br":
 		attachments = []nslack.Attachment{
-			header, br,
+			header, bug,
 		}
 	case "feature", "fr", "enhancement":
 		attachments = []nslack.Attachment{
-			header, fr,
+			header, feature,
 		}
-	case "inconsistency":
+	case "inconsistency", "incon":
 		attachments = []nslack.Attachment{
-			header, incon,
+			header, inconsistency,
 		}
 	default:
 		attachments = []nslack.Attachment{
-			header, br, fr, incon,
+			header, bug, feature, inconsistency,
 		}
 	}
 
 	s.logger.Info("Responding to issues request")
-	channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionAttachments(attachments...))
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachments...))
 	if err != nil {
 		s.logger.WithError(err).Error("failed to respond to request for help.")
 		return
@@ -0,0 +1,338 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/eveisesi/eb2"
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxUnfurledKillmails caps the number of killmails unfurled from a single message
+	maxUnfurledKillmails = 3
+
+	// unfurlTimeout is the longest unfurling the killmails of a single message is allowed to take
+	unfurlTimeout = time.Second * 30
+)
+
+var (
+	// zkillURLRe matches links to kills on zKillboard, i.e. https://zkillboard.com/kill/81733283/
+	zkillURLRe = regexp.MustCompile(`https?://(?:www\.)?zkillboard\.com/kill/(\d+)`)
+
+	// killmailRefRe matches a killmail id followed by its hash, i.e. 81733283/2d4c8f... or 81733283 2d4c8f...
+	killmailRefRe = regexp.MustCompile(`\b(\d{5,})[/ :]([0-9a-fA-F]{40})\b`)
+
+	zkillClient = &http.Client{Timeout: time.Second * 10}
+)
+
+type GetKillmailsKillmailIdKillmailHashOk struct {
+	Attackers     []*GetKillmailsKillmailIdKillmailHashAttacker `json:"attackers,omitempty"`
+	KillmailId    int32                                         `json:"killmail_id,omitempty"`
+	KillmailTime  time.Time                                     `json:"killmail_time,omitempty"`
+	MoonId        int32                                         `json:"moon_id,omitempty"`
+	SolarSystemId int32                                         `json:"solar_system_id,omitempty"`
+	Victim        GetKillmailsKillmailIdKillmailHashVictim      `json:"victim,omitempty"`
+	WarId         int32                                         `json:"war_id,omitempty"`
+}
+
+type GetKillmailsKillmailIdKillmailHashAttacker struct {
+	AllianceId     int32   `json:"alliance_id,omitempty"`
+	CharacterId    int32   `json:"character_id,omitempty"`
+	CorporationId  int32   `json:"corporation_id,omitempty"`
+	DamageDone     int32   `json:"damage_done,omitempty"`
+	FactionId      int32   `json:"faction_id,omitempty"`
+	FinalBlow      bool    `json:"final_blow,omitempty"`
+	SecurityStatus float32 `json:"security_status,omitempty"`
+	ShipTypeId     int32   `json:"ship_type_id,omitempty"`
+	WeaponTypeId   int32   `json:"weapon_type_id,omitempty"`
+}
+
+type GetKillmailsKillmailIdKillmailHashVictim struct {
+	AllianceId    int32 `json:"alliance_id,omitempty"`
+	CharacterId   int32 `json:"character_id,omitempty"`
+	CorporationId int32 `json:"corporation_id,omitempty"`
+	DamageTaken   int32 `json:"damage_taken,omitempty"`
+	FactionId     int32 `json:"faction_id,omitempty"`
+	ShipTypeId    int32 `json:"ship_type_id,omitempty"`
+}
+
+// zkillKill is the part of a zKillboard kill that is needed to fetch the killmail from ESI
+type zkillKill struct {
+	KillmailID int64 `json:"killmail_id"`
+	ZKB        struct {
+		Hash string `json:"hash"`
+	} `json:"zkb"`
+}
+
+// killmailRef identifies a killmail. The hash is empty when it still has to be looked up on zKillboard
+type killmailRef struct {
+	id   int64
+	hash string
+}
+
+func (s *service) makeKillmailMessage(event Event) {
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	refs := findKillmailRefs(strings.Join(event.args, " "), true)
+	if len(refs) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply a killmail id and hash, or a link to the kill on zKillboard", false))
+		return
+	}
+
+	s.postKillmail(event, server, refs[0])
+
+}
+
+// unfurlKillmails replies with a card for every killmail referenced in a message that wasn't addressed to the bot.
+// An id followed by a hash is easily mistaken for a commit, so those are only unfurled in the channels configured
+// with SLACK_UNFURL_CHANNELS. Links to zKillboard are unfurled everywhere
+func (s *service) unfurlKillmails(sevent *slackevents.MessageEvent) {
+
+	refs := findKillmailRefs(sevent.Text, strInStrSlice(sevent.Channel, s.config.SlackUnfurlChannels))
+	if len(refs) == 0 {
+		return
+	}
+
+	if len(refs) > maxUnfurledKillmails {
+		refs = refs[:maxUnfurledKillmails]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unfurlTimeout)
+	defer cancel()
+
+	event := Event{ctx: ctx, origin: sevent}
+	for _, ref := range refs {
+		s.postKillmail(event, eb2.ESI_TRANQUILITY, ref)
+	}
+
+}
+
+// findKillmailRefs returns every killmail referenced in the text by zKillboard link, and by id and hash when hashes is true
+func findKillmailRefs(text string, hashes bool) []killmailRef {
+
+	var refs []killmailRef
+	seen := make(map[int64]bool)
+
+	if hashes {
+		for _, match := range killmailRefRe.FindAllStringSubmatch(text, -1) {
+			id, err := strconv.ParseInt(match[1], 10, 64)
+			if err != nil || seen[id] {
+				continue
+			}
+			seen[id] = true
+			refs = append(refs, killmailRef{id: id, hash: strings.ToLower(match[2])})
+		}
+	}
+
+	for _, match := range zkillURLRe.FindAllStringSubmatch(text, -1) {
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		refs = append(refs, killmailRef{id: id})
+	}
+
+	return refs
+
+}
+
+func (s *service) postKillmail(event Event, server string, ref killmailRef) {
+
+	ctx := event.Context()
+
+	if ref.hash == "" {
+		hash, err := s.fetchZKillHash(ctx, ref.id)
+		if err != nil {
+			s.logger.WithError(err).WithField("killmail_id", ref.id).Error("failed to fetch killmail hash from zkillboard")
+			_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Unable to find the hash of killmail %d on zKillboard", ref.id), false))
+			return
+		}
+		ref.hash = hash
+	}
+
+	resp, err := s.esi.Get(ctx, esiURL(server, fmt.Sprintf("/v1/killmails/%d/%s/", ref.id, ref.hash), nil))
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("failed to fetch killmail %d. esi responded with %d: %s", ref.id, resp.StatusCode, esiErrorMessage(resp.Body)), false))
+		return
+	}
+
+	var killmail GetKillmailsKillmailIdKillmailHashOk
+	err = json.Unmarshal(resp.Body, &killmail)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("failed to decode killmail %d", ref.id), false))
+		return
+	}
+
+	attachment := s.buildKillmailCard(ctx, server, &killmail)
+
+	s.logger.Info("Responding to request for killmail")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for killmail.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for killmail")
+
+}
+
+func (s *service) buildKillmailCard(ctx context.Context, server string, killmail *GetKillmailsKillmailIdKillmailHashOk) nslack.Attachment {
+
+	victim := killmail.Victim
+
+	var finalBlow *GetKillmailsKillmailIdKillmailHashAttacker
+	for _, attacker := range killmail.Attackers {
+		if attacker.FinalBlow {
+			finalBlow = attacker
+			break
+		}
+	}
+
+	ids := []int64{
+		int64(victim.CharacterId), int64(victim.CorporationId), int64(victim.AllianceId), int64(victim.FactionId),
+		int64(victim.ShipTypeId), int64(killmail.SolarSystemId),
+	}
+	if finalBlow != nil {
+		ids = append(ids, int64(finalBlow.CharacterId), int64(finalBlow.CorporationId), int64(finalBlow.FactionId), int64(finalBlow.ShipTypeId))
+	}
+
+	// Everything on the card is resolved in a single call to /universe/names
+	names := s.nameMap(ctx, server, ids...)
+
+	color := "#3AA3E3"
+	location := nameOrID(names, int64(killmail.SolarSystemId))
+	var system GetUniverseSystemsSystemIdOk
+	if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v4/universe/systems/%d/", killmail.SolarSystemId), nil), &system) {
+		_, color = securityBand(system.SecurityStatus)
+		location = fmt.Sprintf("%s (%.1f)", location, roundSecurity(system.SecurityStatus))
+	}
+
+	ship := nameOrID(names, int64(victim.ShipTypeId))
+	pilot := entityLine(names, int64(victim.CharacterId), int64(victim.CorporationId), int64(victim.AllianceId), int64(victim.FactionId))
+
+	blow := "-"
+	if finalBlow != nil {
+		blow = entityLine(names, int64(finalBlow.CharacterId), int64(finalBlow.CorporationId), 0, int64(finalBlow.FactionId))
+		if finalBlow.ShipTypeId != 0 {
+			blow = fmt.Sprintf("%s in a %s", blow, nameOrID(names, int64(finalBlow.ShipTypeId)))
+		}
+	}
+
+	return nslack.Attachment{
+		Color:     color,
+		Title:     fmt.Sprintf("%s lost a %s", victimName(names, victim), ship),
+		TitleLink: fmt.Sprintf("https://zkillboard.com/kill/%d/", killmail.KillmailId),
+		ThumbURL:  fmt.Sprintf("%s/types/%d/render?size=64", imageServer, victim.ShipTypeId),
+		Fields: []nslack.AttachmentField{
+			{Title: "Victim", Value: pilot, Short: true},
+			{Title: "Ship", Value: ship, Short: true},
+			{Title: "Location", Value: location, Short: true},
+			{Title: "Time", Value: killmail.KillmailTime.Format("2006-01-02 15:04:05"), Short: true},
+			{Title: "Attackers", Value: humanize.Comma(int64(len(killmail.Attackers))), Short: true},
+			{Title: "Damage Taken", Value: humanize.Comma(int64(victim.DamageTaken)), Short: true},
+			{Title: "Final Blow", Value: blow},
+		},
+		Footer:   fmt.Sprintf("Killmail %d", killmail.KillmailId),
+		Fallback: fmt.Sprintf("%s lost a %s in %s", victimName(names, victim), ship, location),
+	}
+
+}
+
+// fetchZKillHash looks up the hash of a killmail on zKillboard, which ESI needs to return the killmail
+func (s *service) fetchZKillHash(ctx context.Context, id int64) (string, error) {
+
+	uri := fmt.Sprintf("%s/api/killID/%d/", strings.TrimSuffix(s.config.ZKillboardURL, "/"), id)
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build request to zkillboard")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", s.config.ESIUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := zkillClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to make request to zkillboard")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("zkillboard responded with %d", resp.StatusCode)
+	}
+
+	var kills []*zkillKill
+	err = json.NewDecoder(resp.Body).Decode(&kills)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode response from zkillboard")
+	}
+
+	for _, kill := range kills {
+		if kill.KillmailID == id && kill.ZKB.Hash != "" {
+			return kill.ZKB.Hash, nil
+		}
+	}
+
+	return "", fmt.Errorf("zkillboard does not know of killmail %d", id)
+
+}
+
+// entityLine renders a pilot as "Name (Corporation / Alliance)", falling back to the
+// corporation or faction for npcs and structures that don't have a character
+func entityLine(names map[int64]string, character, corporation, alliance, faction int64) string {
+
+	var owners []string
+	for _, id := range []int64{corporation, alliance} {
+		if id != 0 {
+			owners = append(owners, nameOrID(names, id))
+		}
+	}
+
+	if character == 0 {
+		if len(owners) == 0 {
+			return nameOrID(names, faction)
+		}
+		return strings.Join(owners, " / ")
+	}
+
+	if len(owners) == 0 {
+		return nameOrID(names, character)
+	}
+
+	return fmt.Sprintf("%s (%s)", nameOrID(names, character), strings.Join(owners, " / "))
+
+}
+
+func victimName(names map[int64]string, victim GetKillmailsKillmailIdKillmailHashVictim) string {
+	switch {
+	case victim.CharacterId != 0:
+		return nameOrID(names, int64(victim.CharacterId))
+	case victim.CorporationId != 0:
+		return nameOrID(names, int64(victim.CorporationId))
+	}
+
+	return nameOrID(names, int64(victim.FactionId))
+}
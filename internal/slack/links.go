@@ -44,7 +44,7 @@ func (s *service) makeLinkMessage(event Event) {
 	}
 
 	s.logger.Info("Responding to a request for a link")
-	channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(text, false), nslack.MsgOptionPostMessageParameters(nslack.PostMessageParameters{
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionText(text, false), nslack.MsgOptionPostMessageParameters(nslack.PostMessageParameters{
 		UnfurlLinks: true,
 	}))
 	if err != nil {
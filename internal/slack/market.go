@@ -0,0 +1,306 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	nslack "github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// marketPercentile is the share of the volume on each side of the book used for the percentile price
+const marketPercentile = 0.05
+
+type marketHub struct {
+	name      string
+	regionID  int64
+	region    string
+	stationID int64
+}
+
+// marketHubs are the trade hubs that can be passed with --hub. Orders are filtered down to the
+// hubs station, while --region considers every order in the region
+var marketHubs = map[string]marketHub{
+	"jita":    {name: "Jita", regionID: 10000002, region: "The Forge", stationID: 60003760},
+	"amarr":   {name: "Amarr", regionID: 10000043, region: "Domain", stationID: 60008494},
+	"dodixie": {name: "Dodixie", regionID: 10000032, region: "Sinq Laison", stationID: 60011866},
+	"rens":    {name: "Rens", regionID: 10000030, region: "Heimatar", stationID: 60004588},
+	"hek":     {name: "Hek", regionID: 10000042, region: "Metropolis", stationID: 60005686},
+}
+
+type GetMarketsRegionIdOrders200Ok struct {
+	IsBuyOrder   bool    `json:"is_buy_order"`
+	LocationId   int64   `json:"location_id"`
+	OrderId      int64   `json:"order_id"`
+	Price        float64 `json:"price"`
+	TypeId       int32   `json:"type_id"`
+	VolumeRemain int64   `json:"volume_remain"`
+}
+
+type GetMarketsPrices200Ok struct {
+	AdjustedPrice float64 `json:"adjusted_price"`
+	AveragePrice  float64 `json:"average_price"`
+	TypeId        int32   `json:"type_id"`
+}
+
+// bookSide summarises one side of the order book, sorted best price first
+type bookSide struct {
+	orders     int
+	best       float64
+	topVolume  int64
+	totalVol   int64
+	percentile float64
+}
+
+func summariseBook(orders []*GetMarketsRegionIdOrders200Ok, buy bool) bookSide {
+
+	sort.Slice(orders, func(i, j int) bool {
+		if buy {
+			return orders[i].Price > orders[j].Price
+		}
+		return orders[i].Price < orders[j].Price
+	})
+
+	var side bookSide
+	side.orders = len(orders)
+	if len(orders) == 0 {
+		return side
+	}
+
+	side.best = orders[0].Price
+	for _, order := range orders {
+		side.totalVol += order.VolumeRemain
+		if order.Price == side.best {
+			side.topVolume += order.VolumeRemain
+		}
+	}
+
+	// The percentile price is the volume weighted average of the best orders
+	// making up the first marketPercentile of the volume on this side of the book
+	target := float64(side.totalVol) * marketPercentile
+	if target < 1 {
+		target = 1
+	}
+
+	var filled, value float64
+	for _, order := range orders {
+		take := float64(order.VolumeRemain)
+		if filled+take > target {
+			take = target - filled
+		}
+		filled += take
+		value += take * order.Price
+		if filled >= target {
+			break
+		}
+	}
+	if filled > 0 {
+		side.percentile = value / filled
+	}
+
+	return side
+
+}
+
+func (s *service) makeMarketPriceMessage(event Event) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply the id or name of the type to price", false))
+		return
+	}
+
+	ctx := event.Context()
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	// Prices are only ever for a single type, so names don't need to be quoted
+	arg := strings.Join(event.args, " ")
+	typeID, candidates, err := s.resolveType(ctx, server, arg)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	if len(candidates) > 0 {
+		text := fmt.Sprintf("%s matches more than one type, did you mean one of these?\n```%s```", arg, renderNameTable(candidates))
+		_, _, _ = s.reply(event, nslack.MsgOptionText(text, false))
+		return
+	}
+
+	hub, err := s.marketLocation(ctx, server, event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	typeName := strconv.FormatInt(typeID, 10)
+	names, err := s.resolveNames(ctx, server, []int64{typeID})
+	if err == nil && len(names) == 1 {
+		typeName = names[0].Name
+	}
+
+	orders, err := s.fetchMarketOrders(ctx, server, hub.regionID, typeID)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	var buys, sells []*GetMarketsRegionIdOrders200Ok
+	for _, order := range orders {
+		if hub.stationID != 0 && order.LocationId != hub.stationID {
+			continue
+		}
+		if order.IsBuyOrder {
+			buys = append(buys, order)
+			continue
+		}
+		sells = append(sells, order)
+	}
+
+	buy := summariseBook(buys, true)
+	sell := summariseBook(sells, false)
+
+	var prices []*GetMarketsPrices200Ok
+	adjusted, average := "-", "-"
+	if s.getESIJSON(ctx, esiURL(server, "/v1/markets/prices/", nil), &prices) {
+		for _, price := range prices {
+			if int64(price.TypeId) == typeID {
+				adjusted = formatISK(price.AdjustedPrice)
+				average = formatISK(price.AveragePrice)
+				break
+			}
+		}
+	}
+
+	location := hub.region
+	if hub.stationID != 0 {
+		location = fmt.Sprintf("%s (%s)", hub.name, hub.region)
+	}
+
+	spread := "-"
+	if buy.orders > 0 && sell.orders > 0 && sell.best > 0 {
+		spread = fmt.Sprintf("%s (%.2f%%)", formatISK(sell.best-buy.best), (sell.best-buy.best)/sell.best*100)
+	}
+
+	sideValue := func(side bookSide, price float64) string {
+		if side.orders == 0 {
+			return "No orders"
+		}
+		return formatISK(price)
+	}
+
+	attachment := nslack.Attachment{
+		Color: "good",
+		Title: fmt.Sprintf("%s in %s", typeName, location),
+		Fields: []nslack.AttachmentField{
+			{Title: "Best Sell", Value: sideValue(sell, sell.best), Short: true},
+			{Title: "Best Buy", Value: sideValue(buy, buy.best), Short: true},
+			{Title: "Sell Volume At Best", Value: humanize.Comma(sell.topVolume), Short: true},
+			{Title: "Buy Volume At Best", Value: humanize.Comma(buy.topVolume), Short: true},
+			{Title: "Sell 5% Percentile", Value: sideValue(sell, sell.percentile), Short: true},
+			{Title: "Buy 5% Percentile", Value: sideValue(buy, buy.percentile), Short: true},
+			{Title: "Spread", Value: spread, Short: true},
+			{Title: "Orders (Sell / Buy)", Value: fmt.Sprintf("%d / %d", sell.orders, buy.orders), Short: true},
+			{Title: "Average Price", Value: average, Short: true},
+			{Title: "Adjusted Price", Value: adjusted, Short: true},
+		},
+		Fallback: fmt.Sprintf("%s in %s: sell %s, buy %s", typeName, location, sideValue(sell, sell.best), sideValue(buy, buy.best)),
+	}
+
+	s.logger.Info("Responding to request for market prices")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for market prices.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for market prices")
+
+}
+
+// marketLocation determines where to price the type from the --hub and --region flags, defaulting to Jita
+func (s *service) marketLocation(ctx context.Context, server string, event Event) (marketHub, error) {
+
+	if name, ok := event.flags["hub"]; ok {
+		hub, ok := marketHubs[strings.ToLower(name)]
+		if !ok {
+			hubs := make([]string, 0, len(marketHubs))
+			for k := range marketHubs {
+				hubs = append(hubs, k)
+			}
+			sort.Strings(hubs)
+			return marketHub{}, fmt.Errorf("%s is not a hub I know of. Valid hubs are %s", name, strings.Join(hubs, ", "))
+		}
+		return hub, nil
+	}
+
+	region, ok := event.flags["region"]
+	if !ok {
+		return marketHubs["jita"], nil
+	}
+
+	id, name, err := s.resolveID(ctx, server, region, "region")
+	if err != nil {
+		return marketHub{}, err
+	}
+
+	if name == "" {
+		name = region
+	}
+
+	return marketHub{regionID: id, region: name}, nil
+
+}
+
+func (s *service) fetchMarketOrders(ctx context.Context, server string, regionID, typeID int64) ([]*GetMarketsRegionIdOrders200Ok, error) {
+
+	var orders []*GetMarketsRegionIdOrders200Ok
+	for page, pages := 1, 1; page <= pages; page++ {
+		query := url.Values{}
+		query.Set("order_type", "all")
+		query.Set("type_id", strconv.FormatInt(typeID, 10))
+		query.Set("page", strconv.Itoa(page))
+
+		resp, err := s.esi.Get(ctx, esiURL(server, fmt.Sprintf("/v1/markets/%d/orders/", regionID), query))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch market orders. esi responded with %d: %s", resp.StatusCode, esiErrorMessage(resp.Body))
+		}
+
+		var chunk []*GetMarketsRegionIdOrders200Ok
+		err = json.Unmarshal(resp.Body, &chunk)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode market orders")
+		}
+
+		orders = append(orders, chunk...)
+
+		if p, err := strconv.Atoi(resp.Header.Get("X-Pages")); err == nil {
+			pages = p
+		}
+	}
+
+	return orders, nil
+
+}
+
+func formatISK(v float64) string {
+	return humanize.CommafWithDigits(v, 2) + " ISK"
+}
@@ -0,0 +1,126 @@
+package slack
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	nslack "github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *service) makeNameLookupMessage(event Event) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply at least one id to resolve", false))
+		return
+	}
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	var ids []int64
+	var notes []string
+	seen := make(map[int64]bool)
+	for _, arg := range event.args {
+		id, err := strconv.ParseInt(strings.Trim(arg, ","), 10, 64)
+		if err != nil || id <= 0 {
+			notes = append(notes, fmt.Sprintf("%s is not a valid id, skipping", arg))
+			continue
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(strings.Join(notes, "\n"), false))
+		return
+	}
+
+	names, err := s.resolveNames(event.Context(), server, ids)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	s.postNameTable(event, names, notes)
+
+}
+
+func (s *service) makeIDLookupMessage(event Event) {
+
+	// Without any names to resolve this is a request for the id ranges docs
+	if len(event.args) == 0 {
+		s.makeLinkMessage(event)
+		return
+	}
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	names, err := s.resolveIDs(event.Context(), server, event.args)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	resolved := make(map[string]bool)
+	for _, name := range names {
+		resolved[strings.ToLower(name.Name)] = true
+	}
+
+	var notes []string
+	for _, arg := range event.args {
+		if !resolved[strings.ToLower(arg)] {
+			notes = append(notes, fmt.Sprintf("Unable to find anything named %s", arg))
+		}
+	}
+
+	s.postNameTable(event, names, notes)
+
+}
+
+func (s *service) postNameTable(event Event, names []*UniverseName, notes []string) {
+
+	text := strings.Join(notes, "\n")
+	if len(names) > 0 {
+		text = fmt.Sprintf("```%s```\n%s", renderNameTable(names), text)
+	}
+
+	s.logger.Info("Responding to request for name resolution")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionText(text, false))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for name resolution.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for name resolution")
+
+}
+
+func renderNameTable(names []*UniverseName) string {
+
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tCategory")
+	for _, name := range names {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", name.ID, name.Name, name.Category)
+	}
+	_ = w.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+
+}
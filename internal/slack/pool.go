@@ -0,0 +1,55 @@
+package slack
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool runs jobs on at most size goroutines at a time. Submitting a job blocks
+// until a worker is free, and once the context is cancelled no further jobs are started.
+// Jobs must not submit work to the pool they are running on, use a pool of their own instead
+type workerPool struct {
+	ctx context.Context
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, size int) *workerPool {
+	return &workerPool{
+		ctx: ctx,
+		sem: make(chan struct{}, size),
+	}
+}
+
+// Go runs the job on the pool. It returns false without running the job when the context is cancelled
+func (p *workerPool) Go(job func(ctx context.Context)) bool {
+
+	select {
+	case <-p.ctx.Done():
+		return false
+	case p.sem <- struct{}{}:
+	}
+
+	if p.ctx.Err() != nil {
+		<-p.sem
+		return false
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.sem }()
+
+		job(p.ctx)
+	}()
+
+	return true
+
+}
+
+// Wait blocks until every job that was started has returned. The error of the context is returned
+// so that callers can tell whether all of the jobs ran
+func (p *workerPool) Wait() error {
+	p.wg.Wait()
+	return p.ctx.Err()
+}
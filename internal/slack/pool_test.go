@@ -0,0 +1,357 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/esi"
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeESI answers GET requests with the value stored for their path and resolves ids
+// and names from its own list of types. Paths of servers other than Tranquility are
+// prefixed with their datasource. Unknown paths are answered with a 404
+type fakeESI struct {
+	mu     sync.Mutex
+	bodies map[string]interface{}
+	names  map[int64]string
+	gets   []string
+}
+
+func newFakeESI() *fakeESI {
+	return &fakeESI{
+		bodies: make(map[string]interface{}),
+		names:  make(map[int64]string),
+	}
+}
+
+func (f *fakeESI) Do(ctx context.Context, req *http.Request) (*esi.Response, error) {
+	return f.Get(ctx, req.URL.String())
+}
+
+func (f *fakeESI) Get(ctx context.Context, uri string) (*esi.Response, error) {
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// Give the other lookups a chance to run while this one is in flight
+	time.Sleep(time.Millisecond)
+
+	key := u.Query().Get("datasource") + u.Path
+
+	f.mu.Lock()
+	f.gets = append(f.gets, key)
+	body, ok := f.bodies[key]
+	f.mu.Unlock()
+
+	if !ok {
+		return fakeESIResponse(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+
+	return fakeESIResponse(http.StatusOK, body)
+
+}
+
+func (f *fakeESI) Post(ctx context.Context, uri string, body interface{}) (*esi.Response, error) {
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Path {
+	case "/v3/universe/names/":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var names []*UniverseName
+		for _, id := range body.([]int64) {
+			names = append(names, &UniverseName{ID: id, Name: f.names[id], Category: "inventory_type"})
+		}
+		return fakeESIResponse(http.StatusOK, names)
+	case "/v1/universe/ids/":
+		// No exact matches, so that names are looked up in the type index
+		return fakeESIResponse(http.StatusOK, map[string]interface{}{})
+	}
+
+	return fakeESIResponse(http.StatusNotFound, map[string]string{"error": "not found"})
+
+}
+
+func (f *fakeESI) State() map[string]esi.State {
+	return map[string]esi.State{}
+}
+
+func fakeESIResponse(status int, body interface{}) (*esi.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &esi.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{},
+		Body:       data,
+	}, nil
+}
+
+// TestTypeLookupsShareIndexAndDogmaCache runs type lookups from several commands at once while the type
+// index and the dogma cache are refreshed underneath them. Run it with -race to check the shared state
+func TestTypeLookupsShareIndexAndDogmaCache(t *testing.T) {
+
+	const (
+		attributes = 20
+		effects    = 10
+		commands   = 4
+	)
+
+	fake := newFakeESI()
+	types := []string{"Rifter", "Slasher", "Breacher", "Burst", "Probe", "Atron"}
+	typeIDs := make([]int64, 0, len(types))
+	for i, name := range types {
+		id := int64(587 + i)
+		typeIDs = append(typeIDs, id)
+		fake.names[id] = name
+
+		tp := &GetUniverseTypesTypeIdOk{TypeId: int32(id), Name: name, GroupId: 25}
+		for a := 1; a <= attributes; a++ {
+			tp.DogmaAttributes = append(tp.DogmaAttributes, &GetUniverseTypesTypeIdDogmaAttribute{AttributeId: int32(a), Value: float32(a)})
+		}
+		for e := 1; e <= effects; e++ {
+			tp.DogmaEffects = append(tp.DogmaEffects, &GetUniverseTypesTypeIdDogmaEffect{EffectId: int32(e)})
+		}
+		fake.bodies[fmt.Sprintf("/latest/universe/types/%d/", id)] = tp
+	}
+
+	var attributeIDs, effectIDs []int32
+	for a := 1; a <= attributes; a++ {
+		attributeIDs = append(attributeIDs, int32(a))
+		fake.bodies[fmt.Sprintf("/v1/dogma/attributes/%d/", a)] = GetDogmaAttributesAttributeIdOk{AttributeId: int32(a), Name: fmt.Sprintf("attribute%d", a)}
+	}
+	for e := 1; e <= effects; e++ {
+		effectIDs = append(effectIDs, int32(e))
+		fake.bodies[fmt.Sprintf("/v1/dogma/effects/%d/", e)] = GetDogmaEffectsEffectIdOk{EffectId: int32(e), Name: fmt.Sprintf("effect%d", e)}
+	}
+	fake.bodies["/v1/dogma/attributes/"] = attributeIDs
+	fake.bodies["/v1/dogma/effects/"] = effectIDs
+	fake.bodies["/v1/universe/types/"] = typeIDs
+
+	var mu sync.Mutex
+	var posted []string
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		mu.Lock()
+		posted = append(posted, r.PostForm.Get("text"))
+		mu.Unlock()
+
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C0123","ts":"1589500000.000100"}`))
+	}))
+	defer slackAPI.Close()
+
+	dir, err := ioutil.TempDir("", "eb2-pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	names := make(map[int64]string, len(fake.names))
+	for id, name := range fake.names {
+		names[id] = name
+	}
+
+	s := &service{
+		logger:  logger,
+		config:  &eb2.Config{},
+		goslack: nslack.New("xoxb-test", nslack.OptionAPIURL(slackAPI.URL+"/")),
+		esi:     fake,
+		types:   &typeIndex{names: names, built: time.Now()},
+		dogma:   newDogmaCache(filepath.Join(dir, "dogma.json")),
+	}
+
+	var refreshes int32
+	var wg sync.WaitGroup
+	for i := 0; i < commands; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			defer cancel()
+
+			s.makeESITypeRequestMessage(Event{
+				ctx:    ctx,
+				origin: &slackevents.MessageEvent{Channel: "C0123"},
+				args:   types,
+			})
+		}()
+	}
+
+	for _, refresh := range []func(){s.refreshTypeIndex, s.refreshDogma} {
+		refresh := refresh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refresh()
+			atomic.AddInt32(&refreshes, 1)
+		}()
+	}
+
+	wg.Wait()
+
+	if refreshes != 2 {
+		t.Fatalf("expected both refreshes to finish, %d did", refreshes)
+	}
+
+	if len(posted) != commands*len(types) {
+		t.Fatalf("expected %d cards to be posted, got %d: %q", commands*len(types), len(posted), posted)
+	}
+
+	seen := make(map[string]int)
+	for _, text := range posted {
+		seen[strings.SplitN(text, " (", 2)[0]]++
+	}
+	for _, name := range types {
+		if seen[name] != commands {
+			t.Errorf("expected %s to be posted %d times, got %d", name, commands, seen[name])
+		}
+	}
+
+	for a := int32(1); a <= attributes; a++ {
+		if attr, ok := s.dogma.attribute(a); !ok || attr.Name != fmt.Sprintf("attribute%d", a) {
+			t.Errorf("expected attribute %d to be cached", a)
+		}
+	}
+	for e := int32(1); e <= effects; e++ {
+		if effect, ok := s.dogma.effect(e); !ok || effect.Name != fmt.Sprintf("effect%d", e) {
+			t.Errorf("expected effect %d to be cached", e)
+		}
+	}
+
+}
+
+// TestSerenityTypeLookupBypassesDogmaCache looks up a type on Serenity while the dogma cache holds the
+// Tranquility version of its attribute. The attribute has to come from Serenity and must not end up in the cache
+func TestSerenityTypeLookupBypassesDogmaCache(t *testing.T) {
+
+	fake := newFakeESI()
+	fake.bodies["serenity/latest/universe/types/587/"] = &GetUniverseTypesTypeIdOk{
+		TypeId:          587,
+		Name:            "Rifter",
+		GroupId:         25,
+		DogmaAttributes: []*GetUniverseTypesTypeIdDogmaAttribute{{AttributeId: 37, Value: 350}},
+		DogmaEffects:    []*GetUniverseTypesTypeIdDogmaEffect{{EffectId: 11}},
+	}
+	fake.bodies["serenity/v1/dogma/attributes/37/"] = GetDogmaAttributesAttributeIdOk{AttributeId: 37, Name: "maxVelocity", DisplayName: "Serenity Velocity", UnitId: 11, Published: true}
+	fake.bodies["serenity/v1/dogma/effects/11/"] = GetDogmaEffectsEffectIdOk{EffectId: 11, Name: "serenityEffect"}
+
+	var mu sync.Mutex
+	var posted []string
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		mu.Lock()
+		posted = append(posted, r.PostForm.Get("attachments"))
+		mu.Unlock()
+
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C0123","ts":"1589500000.000100"}`))
+	}))
+	defer slackAPI.Close()
+
+	dir, err := ioutil.TempDir("", "eb2-dogma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &service{
+		logger:  newTestLogger(),
+		config:  &eb2.Config{},
+		goslack: nslack.New("xoxb-test", nslack.OptionAPIURL(slackAPI.URL+"/")),
+		esi:     fake,
+		types:   &typeIndex{names: map[int64]string{}, built: time.Now()},
+		dogma:   newDogmaCache(filepath.Join(dir, "dogma.json")),
+	}
+	s.dogma.storeAttribute(&GetDogmaAttributesAttributeIdOk{AttributeId: 37, Name: "maxVelocity", DisplayName: "Tranquility Velocity", UnitId: 11, Published: true})
+	s.dogma.storeEffect(&GetDogmaEffectsEffectIdOk{EffectId: 11, Name: "tranquilityEffect"})
+
+	s.makeESITypeRequestMessage(Event{
+		ctx:    context.Background(),
+		origin: &slackevents.MessageEvent{Channel: "C0123"},
+		args:   []string{"587"},
+		flags:  map[string]string{"server": eb2.ESI_SERENITY},
+	})
+
+	if len(posted) != 1 {
+		t.Fatalf("expected a single card to be posted, got %d", len(posted))
+	}
+	if !strings.Contains(posted[0], "Serenity Velocity") || strings.Contains(posted[0], "Tranquility Velocity") {
+		t.Errorf("expected the card to show the attribute as it is on Serenity, got %s", posted[0])
+	}
+
+	fetched := make(map[string]bool)
+	for _, key := range fake.gets {
+		fetched[key] = true
+	}
+	if !fetched["serenity/v1/dogma/attributes/37/"] || !fetched["serenity/v1/dogma/effects/11/"] {
+		t.Errorf("expected the dogma of the type to be fetched from Serenity, got %v", fake.gets)
+	}
+
+	if attr, _ := s.dogma.attribute(37); attr.DisplayName != "Tranquility Velocity" {
+		t.Errorf("expected the cached attribute to be left alone, got %s", attr.DisplayName)
+	}
+	if effect, _ := s.dogma.effect(11); effect.Name != "tranquilityEffect" {
+		t.Errorf("expected the cached effect to be left alone, got %s", effect.Name)
+	}
+
+}
+
+func TestWorkerPoolStopsOnCancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := newWorkerPool(ctx, 2)
+
+	var ran int32
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		pool.Go(func(ctx context.Context) {
+			<-release
+			atomic.AddInt32(&ran, 1)
+		})
+	}
+
+	cancel()
+	if pool.Go(func(ctx context.Context) { t.Error("job ran after the context was cancelled") }) {
+		t.Error("expected Go to refuse jobs once the context is cancelled")
+	}
+
+	close(release)
+	if err := pool.Wait(); err != context.Canceled {
+		t.Errorf("expected Wait to return context.Canceled, got %v", err)
+	}
+	if ran != 2 {
+		t.Errorf("expected the jobs started before the cancel to finish, %d did", ran)
+	}
+
+}
@@ -2,17 +2,16 @@ package slack
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/esi"
 	nslack "github.com/nlopes/slack"
 	"github.com/sirupsen/logrus"
 )
@@ -22,7 +21,7 @@ import (
 // 	if len(event.args) != 1 {
 // 		err := errors.New("this command excepts a single argument, which should be the id of the item you are need details for")
 // 		// TODO: Return Parsing Error
-// 		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
+// 		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
 // 	}
 
 // 	event.trigger = fmt.Sprintf("/latest/universe/types/%s", event.args[0])
@@ -52,6 +51,9 @@ type GetUniverseTypesTypeIdOk struct {
 type GetUniverseTypesTypeIdDogmaAttribute struct {
 	AttributeId int32   `json:"attribute_id,omitempty"` /* attribute_id integer */
 	Name        string  `json:"name,omitempty"`
+	DisplayName string  `json:"display_name,omitempty"`
+	UnitId      int32   `json:"unit_id,omitempty"`
+	Published   bool    `json:"published,omitempty"`
 	Value       float32 `json:"value,omitempty"` /* value number */
 }
 
@@ -62,189 +64,256 @@ type GetUniverseTypesTypeIdDogmaEffect struct {
 }
 
 type GetDogmaAttributesAttributeIdOk struct {
-	Name string `json:"name,omitempty"` /* name string */
+	AttributeId int32  `json:"attribute_id,omitempty"` /* attribute_id integer */
+	Name        string `json:"name,omitempty"`         /* name string */
+	DisplayName string `json:"display_name,omitempty"` /* display_name string */
+	Description string `json:"description,omitempty"`  /* description string */
+	UnitId      int32  `json:"unit_id,omitempty"`      /* unit_id integer */
+	Published   bool   `json:"published,omitempty"`    /* published boolean */
 }
 
 type GetDogmaEffectsEffectIdOk struct {
-	Name string `json:"name,omitempty"` /* name string */
+	EffectId    int32  `json:"effect_id,omitempty"`    /* effect_id integer */
+	Name        string `json:"name,omitempty"`         /* name string */
+	DisplayName string `json:"display_name,omitempty"` /* display_name string */
+	Description string `json:"description,omitempty"`  /* description string */
+	Published   bool   `json:"published,omitempty"`    /* published boolean */
 }
 
-var wg sync.WaitGroup
+const (
+	// typeLookupWorkers caps the number of types looked up at the same time by a single command
+	typeLookupWorkers = 3
+
+	// dogmaLookupWorkers caps the number of dogma attributes and effects fetched at the same time for a single type
+	dogmaLookupWorkers = 8
+)
 
 func (s *service) makeESITypeRequestMessage(event Event) {
 	if len(event.args) == 0 {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText("You need to supply at least one type id to lookup", false))
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply at least one type id or name to lookup", false))
 		return
 	} else if len(event.args) > 10 {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText("Please supply a maximum of 10 ids to look up", false))
+		_, _, _ = s.reply(event, nslack.MsgOptionText("Please supply a maximum of 10 types to look up", false))
 		return
 	}
 
-	for _, a := range event.args {
-		start := time.Now()
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
 
-		id, err := strconv.Atoi(a)
-		if err != nil {
-			_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(fmt.Sprintf("%s is not a valid number, skipping", a), false))
-			continue
+	pool := newWorkerPool(event.Context(), typeLookupWorkers)
+	for _, a := range event.args {
+		a := a
+		if !pool.Go(func(ctx context.Context) { s.lookupType(ctx, event, server, a) }) {
+			break
 		}
+	}
 
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			var internalWg sync.WaitGroup
-			esiCalls := 0
+	err = pool.Wait()
+	if err != nil {
+		s.logger.WithError(err).Error("type lookup did not complete")
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("I gave up on looking up some of those types: %s", err.Error()), false))
+	}
 
-			url := fmt.Sprintf("https://esi.evetech.net/latest/universe/types/%d/", id)
+}
 
-			esiCalls++
-			resp, err := s.client.Get(url)
-			if err != nil {
-				_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(fmt.Sprintf("Failed to check id %d. Error: %s", id, err.Error()), false))
-				return
-			}
+// lookupType resolves a single argument of the type lookup command and responds with the card for the type
+func (s *service) lookupType(ctx context.Context, event Event, server, arg string) {
 
-			bd, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(fmt.Sprintf("Failed to decode response from esi for id %d. Error: %s", id, err.Error()), false))
-				return
-			}
+	start := time.Now()
 
-			resp.Body.Close()
+	id, candidates, err := s.resolveType(ctx, server, arg)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("%s, skipping", err.Error()), false))
+		return
+	}
 
-			if resp.StatusCode != http.StatusOK {
-				_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(fmt.Sprintf("Got an error from esi. Code %d, Body: %s", id, string(bd)), false))
-				return
-			}
+	if len(candidates) > 0 {
+		text := fmt.Sprintf("%s matches more than one type, did you mean one of these?\n```%s```", arg, renderNameTable(candidates))
+		_, _, _ = s.reply(event, nslack.MsgOptionText(text, false))
+		return
+	}
 
-			var tp = &GetUniverseTypesTypeIdOk{}
-			err = json.Unmarshal(bd, tp)
-			if err != nil {
-				_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(fmt.Sprintf("Failed to decode response from esi for id %d. Error: %s", id, err.Error()), false))
-				return
-			}
+	esiCalls := 1
+	resp, err := s.esi.Get(ctx, esiURL(server, fmt.Sprintf("/latest/universe/types/%d/", id), nil))
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Failed to check id %d. Error: %s", id, err.Error()), false))
+		return
+	}
 
-			// Now that we have the type, iterate over all dogma attributes to resolve them (if present)
-			for _, dgm := range tp.DogmaAttributes {
-				internalWg.Add(1)
-				go func(dgm *GetUniverseTypesTypeIdDogmaAttribute) {
-					defer internalWg.Done()
-					url = fmt.Sprintf("https://esi.evetech.net/v1/dogma/attributes/%d/", dgm.AttributeId)
+	if resp.StatusCode != http.StatusOK {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Got an error from esi for id %d. Code %d, Body: %s", id, resp.StatusCode, string(resp.Body)), false))
+		return
+	}
 
-					esiCalls++
-					res, err := s.client.Get(url)
-					if err != nil {
-						return
-					}
+	var tp = &GetUniverseTypesTypeIdOk{}
+	err = json.Unmarshal(resp.Body, tp)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Failed to decode response from esi for id %d. Error: %s", id, err.Error()), false))
+		return
+	}
 
-					bdd, err := ioutil.ReadAll(res.Body)
-					if err != nil {
-						return
-					}
+	esiCalls += s.resolveTypeDogma(ctx, server, tp)
 
-					resp.Body.Close()
+	meta, calls := s.fetchTypeMeta(ctx, server, tp)
+	esiCalls += calls
 
-					if res.StatusCode != http.StatusOK {
-						dgm.Name = "failed to acquire the name of this attribute"
-					}
+	if ctx.Err() != nil {
+		return
+	}
 
-					var attr GetDogmaAttributesAttributeIdOk
-					err = json.Unmarshal(bdd, &attr)
-					if err != nil {
-						return
-					}
+	d := time.Since(start)
+	summary := fmt.Sprintf("%s (%dms) (%d calls to esi)%s", strings.ToUpper(resp.Status), d.Milliseconds(), esiCalls, cacheNote(resp))
 
-					dgm.Name = attr.Name
+	blocks, attachments := buildTypeCard(tp, meta, summary)
 
-				}(dgm)
-			}
+	s.logger.Info("Responding to request for esi data.")
+	_, _, err = s.reply(
+		event,
+		nslack.MsgOptionText(fmt.Sprintf("%s (%d)", tp.Name, tp.TypeId), false),
+		nslack.MsgOptionBlocks(blocks...),
+		nslack.MsgOptionAttachments(attachments...),
+	)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for esi data.")
+		return
+	}
 
-			// Now that we have the type, iterate over all dogma effects to resolve them (if present)
-			for _, dgm := range tp.DogmaEffects {
-				internalWg.Add(1)
-				go func(dgm *GetUniverseTypesTypeIdDogmaEffect) {
-					defer internalWg.Done()
-					url = fmt.Sprintf("https://esi.evetech.net/v1/dogma/effects/%d/", dgm.EffectId)
-
-					esiCalls++
-					res, err := s.client.Get(url)
-					if err != nil {
-						return
-					}
-
-					bdd, err := ioutil.ReadAll(res.Body)
-					if err != nil {
-						return
-					}
-
-					resp.Body.Close()
-
-					if res.StatusCode != http.StatusOK {
-						dgm.Name = "failed to acquire the name of this attribute"
-					}
-
-					var attr GetDogmaAttributesAttributeIdOk
-					err = json.Unmarshal(bdd, &attr)
-					if err != nil {
-						return
-					}
-
-					dgm.Name = attr.Name
-				}(dgm)
-			}
-			internalWg.Wait()
+	if !event.boolFlag("raw") {
+		s.logger.Info("successfully responded to request for esi data")
+		return
+	}
 
-			data, err := json.Marshal(tp)
-			if err != nil {
-				_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText("Internal Error Attempting to Marshal Response", false))
-				return
-			}
-			// From this point down I am just copying from DDs code.. Shameless rip
+	data, err := json.Marshal(tp)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("Internal Error Attempting to Marshal Response", false))
+		return
+	}
+	// From this point down I am just copying from DDs code.. Shameless rip
 
-			dst := new(bytes.Buffer)
-			_ = json.Indent(dst, data, "", "   ")
+	dst := new(bytes.Buffer)
+	_ = json.Indent(dst, data, "", "   ")
 
-			data = dst.Bytes()
+	data = dst.Bytes()
 
-			if len(data) > 1024000 {
-				endtext := []byte("\nand more ...")
-				data = data[:1010]
-				data = append(data, endtext...)
+	if len(data) > 1024000 {
+		endtext := []byte("\nand more ...")
+		data = data[:1010]
+		data = append(data, endtext...)
+	}
+
+	_, err = s.upload(event, nslack.FileUploadParameters{
+		Filename:       "response.json",
+		Filetype:       "json",
+		Content:        string(data),
+		InitialComment: summary,
+		Title:          tp.Name,
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for esi data.")
+		return
+	}
+	s.logger.Info("successfully responded to request for esi data")
+
+}
+
+// resolveTypeDogma fills in the names of the dogma attributes and effects of the type. Types of Tranquility
+// are resolved from the dogma cache and only those it doesn't know about yet are fetched from esi, the
+// cache holds nothing for the other servers so their attributes and effects are always fetched.
+// Every job writes to its own attribute or effect so the type can be shared between them.
+// It returns the number of calls made to esi
+func (s *service) resolveTypeDogma(ctx context.Context, server string, tp *GetUniverseTypesTypeIdOk) int {
+
+	cached := server == eb2.ESI_TRANQUILITY
+	calls := 0
+	pool := newWorkerPool(ctx, dogmaLookupWorkers)
+
+	for _, dgm := range tp.DogmaAttributes {
+		if attr, ok := s.dogma.attribute(dgm.AttributeId); cached && ok {
+			applyDogmaAttribute(dgm, attr)
+			continue
+		}
+
+		dgm := dgm
+		if !pool.Go(func(ctx context.Context) {
+			attr, ok := s.fetchDogmaAttribute(ctx, server, dgm.AttributeId)
+			if !ok {
+				dgm.Name = "failed to acquire the name of this attribute"
+				return
 			}
 
-			d := time.Since(start)
-
-			s.logger.Info("Responding to request for esi data.")
-			_, err = s.goslack.UploadFile(nslack.FileUploadParameters{
-				Filename:       "response.json",
-				Filetype:       "json",
-				Channels:       []string{event.origin.Channel},
-				Content:        string(data),
-				InitialComment: fmt.Sprintf("%s (%dms) (%d calls to esi)", strings.ToUpper(resp.Status), d.Milliseconds(), esiCalls),
-				Title:          tp.Name,
-			})
-			if err != nil {
-				s.logger.WithError(err).Error("failed to respond to request for esi data.")
+			applyDogmaAttribute(dgm, attr)
+		}) {
+			break
+		}
+		calls++
+	}
+
+	for _, dgm := range tp.DogmaEffects {
+		if effect, ok := s.dogma.effect(dgm.EffectId); cached && ok {
+			dgm.Name = effect.Name
+			continue
+		}
+
+		dgm := dgm
+		if !pool.Go(func(ctx context.Context) {
+			effect, ok := s.fetchDogmaEffect(ctx, server, dgm.EffectId)
+			if !ok {
+				dgm.Name = "failed to acquire the name of this effect"
 				return
 			}
-			s.logger.Info("successfully responded to request for esi data")
-		}(id)
+
+			dgm.Name = effect.Name
+		}) {
+			break
+		}
+		calls++
 	}
-	wg.Wait()
 
+	_ = pool.Wait()
+
+	return calls
+
+}
+
+func applyDogmaAttribute(dgm *GetUniverseTypesTypeIdDogmaAttribute, attr *GetDogmaAttributesAttributeIdOk) {
+	dgm.Name = attr.Name
+	dgm.DisplayName = attr.DisplayName
+	dgm.UnitId = attr.UnitId
+	dgm.Published = attr.Published
 }
 
 func (s *service) makeESIDynamicRequestMessage(event Event) {
 
-	parsed, valid := validateRoute(event.trigger)
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	routes, err := s.routeIndex(server)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	// Only the path is validated against the spec, the query string is passed along as is
+	path, query := event.trigger, ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+
+	parsed, valid := validateRoute(path, routes)
 	if !valid {
 
 		attachment := nslack.Attachment{
-			Pretext: "Provided Path is not valid. Please validate the path submitted and try again. The following is the final parsed route and what the engine used to validate this request.",
+			Pretext: fmt.Sprintf("Provided Path is not valid on %s. Please validate the path submitted and try again. The following is the final parsed route and what the engine used to validate this request.", strings.Title(server)),
 			Text:    parsed,
 		}
 		s.logger.Info("Responding to request for esi data.")
-		channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionAttachments(attachment))
+		channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
 		if err != nil {
 			s.logger.WithError(err).Error("failed to respond to request for esi data.")
 			return
@@ -258,45 +327,34 @@ func (s *service) makeESIDynamicRequestMessage(event Event) {
 
 	}
 
-	var base *url.URL
-	var err error
-	base, err = url.Parse(eb2.ESI_URLS[eb2.ESI_TRANQUILITY])
+	uri, err := url.ParseRequestURI(parsed + query)
 	if err != nil {
-		// TODO: Return Parsing Error
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
 	}
 
-	uri, err := url.ParseRequestURI(parsed)
+	uri, err = url.Parse(esiURL(server, uri.Path, uri.Query()))
 	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
-
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
 	}
 
-	uri.Host = base.Host
-	uri.Scheme = base.Scheme
-
 	// Has nothing gone wrong yet? Amazing!!!
 	start := time.Now()
-	resp, err := http.Get(uri.String())
+	resp, err := s.esi.Get(event.Context(), uri.String())
 	if err != nil {
-		// TODO: Error Handling for making the request.
 		// This error does not throw if request.StatusCode != 200.
 		// That is handled later
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
-
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
 	}
-	defer resp.Body.Close()
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), false))
-
-	}
+	data := resp.Body
 
 	if resp.StatusCode != 200 {
 		txt := "The request to %s failed with status code %d and error message %s"
 
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel,
+		_, _, _ = s.reply(event,
 			nslack.MsgOptionText(
 				fmt.Sprintf(
 					txt,
@@ -324,12 +382,11 @@ func (s *service) makeESIDynamicRequestMessage(event Event) {
 	d := time.Since(start)
 
 	s.logger.Info("Responding to request for esi data.")
-	_, err = s.goslack.UploadFile(nslack.FileUploadParameters{
+	_, err = s.upload(event, nslack.FileUploadParameters{
 		Filename:       "response.json",
 		Filetype:       "json",
-		Channels:       []string{event.origin.Channel},
 		Content:        string(data),
-		InitialComment: fmt.Sprintf("%s (%dms)", strings.ToUpper(resp.Status), d.Milliseconds()),
+		InitialComment: fmt.Sprintf("%s (%dms)%s", strings.ToUpper(resp.Status), d.Milliseconds(), cacheNote(resp)),
 		Title:          uri.String(),
 	})
 	if err != nil {
@@ -340,7 +397,28 @@ func (s *service) makeESIDynamicRequestMessage(event Event) {
 
 }
 
-func validateRoute(route string) (string, bool) {
+// cacheNote marks replies that were served from the esi response cache, i.e. " (cached, expires in 43m)"
+func cacheNote(resp *esi.Response) string {
+	if !resp.Cached {
+		return ""
+	}
+
+	return fmt.Sprintf(" (cached, expires in %s)", shortDuration(time.Until(resp.Expires)))
+}
+
+func shortDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d > 0:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return "0s"
+}
+
+func validateRoute(route string, routes [][]string) (string, bool) {
 	version := ""
 	versions := []string{"latest", "legacy", "dev", "v1", "v2", "v3", "v4", "v5", "v6"}
 	parsedCommand := strings.Split(strings.TrimSuffix(strings.TrimPrefix(route, "/"), "/"), "/")
@@ -350,7 +428,7 @@ func validateRoute(route string) (string, bool) {
 	}
 	validRoute := false
 
-	for _, route := range rl {
+	for _, route := range routes {
 		if len(route) != len(parsedCommand) {
 			continue
 		}
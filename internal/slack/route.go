@@ -0,0 +1,211 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	nslack "github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// routeLookupWorkers caps the number of systems looked up at the same time while rendering a route
+const routeLookupWorkers = 8
+
+var routeFlags = []string{"shortest", "secure", "insecure"}
+
+// routeSystem is a single stop along a route
+type routeSystem struct {
+	id       int32
+	name     string
+	security float64
+}
+
+func (s *service) makeRouteMessage(event Event) {
+
+	if len(event.args) != 2 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(`You need to supply an origin and a destination, quote names with spaces in them i.e. "New Caldari"`, false))
+		return
+	}
+
+	ctx := event.Context()
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	flag := "shortest"
+	if v, ok := event.flags["flag"]; ok {
+		flag = strings.ToLower(v)
+		if !strInStrSlice(flag, routeFlags) {
+			_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("%s is not a valid route flag. Valid flags are %s", v, strings.Join(routeFlags, ", ")), false))
+			return
+		}
+	}
+
+	origin, _, err := s.resolveID(ctx, server, event.args[0], "solar_system")
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	destination, _, err := s.resolveID(ctx, server, event.args[1], "solar_system")
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	query := url.Values{}
+	query.Set("flag", flag)
+
+	if v, ok := event.flags["avoid"]; ok {
+		avoid := make([]string, 0)
+		for _, arg := range strings.Split(v, ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				continue
+			}
+
+			id, _, err := s.resolveID(ctx, server, arg, "solar_system")
+			if err != nil {
+				_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+				return
+			}
+			avoid = append(avoid, strconv.FormatInt(id, 10))
+		}
+		if len(avoid) > 0 {
+			query.Set("avoid", strings.Join(avoid, ","))
+		}
+	}
+
+	path, err := s.fetchRoute(ctx, server, origin, destination, query)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	systems, err := s.fetchRouteSystems(ctx, server, path)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("I gave up on looking up the systems along the route: %s", err.Error()), false))
+		return
+	}
+
+	bands := make(map[string]int)
+	stops := make([]string, 0, len(systems))
+	lowest := 1.0
+	for _, system := range systems {
+		band, _ := securityBand(system.security)
+		bands[band]++
+		if system.security < lowest {
+			lowest = system.security
+		}
+		stops = append(stops, fmt.Sprintf("%s %s (%.1f)", securityEmoji(system.security), system.name, roundSecurity(system.security)))
+	}
+
+	// The attachment takes the color of the least secure system along the route
+	_, color := securityBand(lowest)
+
+	first, last := systems[0], systems[len(systems)-1]
+	jumps := len(systems) - 1
+
+	attachment := nslack.Attachment{
+		Color: color,
+		Title: fmt.Sprintf("%s to %s: %d %s (%s)", first.name, last.name, jumps, pluralize(jumps, "jump", "jumps"), flag),
+		Text:  strings.Join(stops, " → "),
+		Footer: fmt.Sprintf(
+			"%d high sec, %d low sec, %d null sec",
+			bands["high sec"], bands["low sec"], bands["null sec"],
+		),
+		Fallback: fmt.Sprintf("%s to %s: %d jumps", first.name, last.name, jumps),
+	}
+
+	s.logger.Info("Responding to request for route")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for route.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for route")
+
+}
+
+func (s *service) fetchRoute(ctx context.Context, server string, origin, destination int64, query url.Values) ([]int32, error) {
+
+	resp, err := s.esi.Get(ctx, esiURL(server, fmt.Sprintf("/v1/route/%d/%d/", origin, destination), query))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("there is no route between those systems")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch route. esi responded with %d: %s", resp.StatusCode, esiErrorMessage(resp.Body))
+	}
+
+	var path []int32
+	err = json.Unmarshal(resp.Body, &path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode route")
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("there is no route between those systems")
+	}
+
+	return path, nil
+
+}
+
+// fetchRouteSystems looks up the name and security status of every system along the path. Systems
+// that can not be fetched are shown by their id with a security status of 0.0
+func (s *service) fetchRouteSystems(ctx context.Context, server string, path []int32) ([]routeSystem, error) {
+
+	systems := make([]routeSystem, len(path))
+
+	pool := newWorkerPool(ctx, routeLookupWorkers)
+	for i, id := range path {
+		i, id := i, id
+		pool.Go(func(ctx context.Context) {
+			systems[i] = routeSystem{id: id, name: strconv.Itoa(int(id))}
+
+			var system GetUniverseSystemsSystemIdOk
+			if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v4/universe/systems/%d/", id), nil), &system) {
+				systems[i].name = system.Name
+				systems[i].security = system.SecurityStatus
+			}
+		})
+	}
+
+	return systems, pool.Wait()
+
+}
+
+func securityEmoji(sec float64) string {
+	switch band, _ := securityBand(sec); band {
+	case "high sec":
+		return ":large_green_circle:"
+	case "low sec":
+		return ":large_orange_circle:"
+	}
+
+	return ":red_circle:"
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
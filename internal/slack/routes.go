@@ -0,0 +1,101 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/eveisesi/eb2"
+	"github.com/pkg/errors"
+)
+
+type swaggerSpec struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// serverFromEvent returns the ESI server the user asked for with either --server or --datasource,
+// defaulting to Tranquility when neither flag is present
+func serverFromEvent(event Event) (string, error) {
+
+	server, ok := event.flags["server"]
+	if !ok {
+		server, ok = event.flags["datasource"]
+	}
+	if !ok {
+		return eb2.ESI_TRANQUILITY, nil
+	}
+
+	server = strings.ToLower(server)
+	if _, ok := eb2.ESI_URLS[server]; !ok {
+		servers := make([]string, 0, len(eb2.ESI_URLS))
+		for k := range eb2.ESI_URLS {
+			servers = append(servers, k)
+		}
+		sort.Strings(servers)
+		return "", fmt.Errorf("%s is not a server I know of. Valid servers are %s", server, strings.Join(servers, ", "))
+	}
+
+	return server, nil
+
+}
+
+// esiURL builds a url for the path on the provided server. Every server other than
+// Tranquility is only reachable when its datasource is passed along with the request
+func esiURL(server, path string, query url.Values) string {
+
+	uri, _ := url.Parse(eb2.ESI_URLS[server])
+	uri.Path = path
+
+	if query == nil {
+		query = url.Values{}
+	}
+	if server != eb2.ESI_TRANQUILITY {
+		query.Set("datasource", server)
+	}
+	uri.RawQuery = query.Encode()
+
+	return uri.String()
+
+}
+
+// routeIndex returns the GET routes of the servers swagger spec, split on their slashes.
+// Tranquility and Serenity do not expose the same set of routes so every server has an index of its own
+func (s *service) routeIndex(server string) ([][]string, error) {
+
+	if cached, found := s.caches["specs"].Get(server); found {
+		return cached.([][]string), nil
+	}
+
+	resp, err := s.esi.Get(context.Background(), esiURL(server, "/latest/swagger.json", nil))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch the %s swagger spec", server)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch the %s swagger spec. esi api responded with an HTTP Status Code of %d", server, resp.StatusCode)
+	}
+
+	var spec swaggerSpec
+	err = json.Unmarshal(resp.Body, &spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode the %s swagger spec", server)
+	}
+
+	index := make([][]string, 0, len(spec.Paths))
+	for path, methods := range spec.Paths {
+		if _, ok := methods["get"]; !ok {
+			continue
+		}
+
+		index = append(index, strings.Split(strings.Trim(path, "/"), "/"))
+	}
+
+	s.caches["specs"].Set(server, index, 0)
+
+	return index, nil
+
+}
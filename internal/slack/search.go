@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eveisesi/eb2"
+	"github.com/google/go-github/v29/github"
+	"github.com/sirupsen/logrus"
+
+	nslack "github.com/nlopes/slack"
+)
+
+// maxSearchResults caps the number of issues listed in reply to a search
+const maxSearchResults = 8
+
+var searchStates = []string{"open", "closed"}
+
+func (s *service) makeIssueSearchMessage(event Event) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply something to search for", false))
+		return
+	}
+
+	query := make([]string, 0, len(event.args)+4)
+	for _, arg := range event.args {
+		if strings.Contains(arg, " ") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		query = append(query, arg)
+	}
+	query = append(query, "is:issue")
+
+	repos := []string{eb2.ESI_ISSUES, eb2.SSO_ISSUES}
+	if v, ok := event.flags["repo"]; ok {
+		repo, ok := issueRepoAliases[strings.ToLower(v)]
+		if !ok || v == "" {
+			_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("%s is not a repository I know of. Valid repositories are esi, sso", v), false))
+			return
+		}
+		repos = []string{fmt.Sprintf("https://github.com/%s/%s", repo[0], repo[1])}
+	}
+	for _, repo := range repos {
+		query = append(query, "repo:"+strings.TrimPrefix(repo, "https://github.com/"))
+	}
+
+	if v, ok := event.flags["state"]; ok {
+		if !strInStrSlice(strings.ToLower(v), searchStates) {
+			_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("%s is not a valid state. Valid states are %s", v, strings.Join(searchStates, ", ")), false))
+			return
+		}
+		query = append(query, "state:"+strings.ToLower(v))
+	}
+
+	if v, ok := event.flags["label"]; ok && v != "" {
+		query = append(query, fmt.Sprintf("label:%q", v))
+	}
+
+	result, _, err := s.gogithub.Search.Issues(event.Context(), strings.Join(query, " "), &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: maxSearchResults},
+	})
+	if msg, ok := githubLimitMessage(err); ok {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(msg, false))
+		return
+	}
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("unable to search Github: %s", err), false))
+		return
+	}
+
+	if len(result.Issues) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("I couldn't find any issues matching %s. If you think you found something new, `%s new` explains how to open an issue", strings.Join(event.args, " "), s.config.SlackPrefixes[0]), false))
+		return
+	}
+
+	lines := make([]string, 0, len(result.Issues))
+	for _, issue := range result.Issues {
+		labels := make([]string, 0, len(issue.Labels))
+		for _, label := range issue.Labels {
+			labels = append(labels, label.GetName())
+		}
+
+		line := fmt.Sprintf("<%s|%s#%d> %s (%s)", issue.GetHTMLURL(), repoFromIssueURL(issue.GetHTMLURL()), issue.GetNumber(), issue.GetTitle(), issue.GetState())
+		if len(labels) > 0 {
+			line = fmt.Sprintf("%s [%s]", line, strings.Join(labels, ", "))
+		}
+		lines = append(lines, line)
+	}
+
+	attachment := nslack.Attachment{
+		Color:    "#3AA3E3",
+		Title:    fmt.Sprintf("Issues matching %s", strings.Join(event.args, " ")),
+		Text:     strings.Join(lines, "\n"),
+		Footer:   fmt.Sprintf("Showing %d of %d results", len(result.Issues), result.GetTotal()),
+		Fallback: strings.Join(lines, "\n"),
+	}
+
+	s.logger.Info("Responding to a request for a gh issue search")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to a request for a gh issue search.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to a request for a gh issue search")
+
+}
+
+// repoFromIssueURL returns the name of the repository an issue belongs to, i.e. esi-issues
+func repoFromIssueURL(uri string) string {
+	parts := strings.Split(strings.TrimPrefix(uri, "https://github.com/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
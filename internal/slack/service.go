@@ -3,11 +3,13 @@ package slack
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"net/url"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/esi"
 	"github.com/google/go-github/v29/github"
 	"github.com/nlopes/slack"
 	nslack "github.com/nlopes/slack"
@@ -19,6 +21,9 @@ import (
 type Service interface {
 	Run()
 	ProcessEvent(context.Context, *slackevents.MessageEvent)
+	ProcessSlashCommand(context.Context, nslack.SlashCommand)
+	ProcessInteraction(context.Context, *Interaction)
+	ProcessGithubEvent(context.Context, string, interface{})
 }
 
 type service struct {
@@ -26,30 +31,53 @@ type service struct {
 	config   *eb2.Config
 	commands []Category
 	flat     []Command
+
+	interactions map[interactionKey]InteractionFunc
+
 	goslack  *nslack.Client
 	gogithub *github.Client
-	client   *http.Client
+	github   *githubTransport
+	esi      esi.Service
+	types    *typeIndex
+	issues   *issueIndex
+	dogma    *dogmaCache
+	feed     *feedState
 	caches   map[string]*cache.Cache
 }
 
 var (
 	layoutESI = "Mon, 02 Jan 2006 15:04:05 MST"
-	rl        = [][]string{}
 )
 
-func New(logger *logrus.Logger, config *eb2.Config) Service {
+// commandTimeout is the longest a single command invocation is allowed to run for
+const commandTimeout = time.Minute * 2
+
+func New(logger *logrus.Logger, config *eb2.Config, esi esi.Service) Service {
+
+	gogithub, transport := newGithubClient(logger, config.GithubToken, config.GithubRateLimitBuffer)
+	if config.GithubAPIURL != "" {
+		baseURL, err := url.Parse(strings.TrimSuffix(config.GithubAPIURL, "/") + "/")
+		if err != nil {
+			logger.WithError(err).Fatal("failed to parse github api url")
+		}
+		gogithub.BaseURL = baseURL
+	}
 
 	s := &service{
 		logger:   logger,
 		config:   config,
-		goslack:  nslack.New(config.SlackAPIToken),
-		gogithub: github.NewClient(nil),
-		client: &http.Client{
-			Timeout: time.Second * 30,
-		},
+		goslack:  nslack.New(config.SlackAPIToken, nslack.OptionAPIURL(config.SlackAPIURL)),
+		gogithub: gogithub,
+		github:   transport,
+		esi:      esi,
+		types:    &typeIndex{},
+		issues:   &issueIndex{},
+		dogma:    newDogmaCache(config.DogmaCachePath),
+		feed:     newFeedState(config.GithubFeedStatePath),
 		caches: map[string]*cache.Cache{
 			"routes": cache.New(cache.NoExpiration, cache.NoExpiration),
 			"etags":  cache.New(cache.NoExpiration, cache.NoExpiration),
+			"specs":  cache.New(time.Hour, time.Hour),
 		},
 	}
 
@@ -57,6 +85,7 @@ func New(logger *logrus.Logger, config *eb2.Config) Service {
 
 	s.commands = commands
 	s.flat = s.flattenCommands(commands)
+	s.interactions = s.buildInteractions(s.flat)
 	version := "latest"
 	routes, err := s.fetchRouteStatuses(version)
 	if err != nil {
@@ -67,12 +96,24 @@ func New(logger *logrus.Logger, config *eb2.Config) Service {
 		s.caches["routes"].Set(version, routes, 0)
 	}
 
-	for _, route := range routes {
-		if route.Method == "get" {
-			s := strings.TrimPrefix(route.Route, "/")
-			s = strings.TrimSuffix(s, "/")
-			rl = append(rl, strings.Split(s, "/"))
-		}
+	_, err = s.routeIndex(eb2.ESI_TRANQUILITY)
+	if err != nil {
+		logger.WithError(err).Error("failed to load esi route index")
+	}
+
+	go s.refreshTypeIndex()
+	go s.refreshIssueIndex()
+
+	err = s.dogma.load()
+	if err != nil {
+		logger.WithError(err).Error("failed to load dogma cache from disk")
+	}
+
+	go s.refreshDogma()
+
+	err = s.feed.load()
+	if err != nil {
+		logger.WithError(err).Error("failed to load github feed state from disk")
 	}
 
 	if config.SlackSendStartupMsg {
@@ -89,6 +130,22 @@ func New(logger *logrus.Logger, config *eb2.Config) Service {
 
 func (s *service) Run() {
 
+	if s.types.stale() {
+		go s.refreshTypeIndex()
+	}
+
+	if s.dogma.stale() {
+		go s.refreshDogma()
+	}
+
+	if s.issues.stale() {
+		go s.refreshIssueIndex()
+	}
+
+	if s.config.GithubFeedChannel != "" && s.feed.due(s.config.GithubFeedInterval) {
+		go s.pollIssueActivity()
+	}
+
 	version := "latest"
 	var cachedRoutes []*eb2.ESIStatus
 	var found bool
@@ -161,7 +218,7 @@ func (s *service) Run() {
 
 	}
 
-	s.MakeESIStatusMessage(s.config.SlackESIStatusChannel, updatedRoutes, "latest")
+	s.MakeESIStatusMessage(Event{origin: &slackevents.MessageEvent{Channel: s.config.SlackESIStatusChannel}}, updatedRoutes, "latest")
 
 }
 
@@ -188,6 +245,7 @@ func (s *service) ProcessEvent(ctx context.Context, sevent *slackevents.MessageE
 	}
 
 	if !valid {
+		s.unfurl(sevent)
 		return
 	}
 
@@ -196,7 +254,8 @@ func (s *service) ProcessEvent(ctx context.Context, sevent *slackevents.MessageE
 	// Example: !esi types 32 = []string{"!esi", "types", "32"}
 	// Example: !esi issues = []string{"!esi", "issues"}
 	// Example: !esi status --location=china = []string{"!esi", "status", "--location=china"}
-	text := strings.Split(sevent.Text, " ")
+	// Example: !esi id "CCP Games" = []string{"!esi", "id", "CCP Games"}
+	text := splitText(sevent.Text)
 	// If text contains just the bot prefix, then we should reply with help.
 	if len(text) == 1 {
 		s.makeHelpMessage(Event{
@@ -210,6 +269,14 @@ func (s *service) ProcessEvent(ctx context.Context, sevent *slackevents.MessageE
 	// Now we want to drop the prefix. It no longer serves a purpose
 	text = text[1:]
 
+	s.invokeCommand(sevent, text, nil)
+
+}
+
+// invokeCommand runs the command triggered by the first word of the text, handing the rest to it as args and flags.
+// Commands invoked through a slash command pass its response url, their replies are posted to it
+func (s *service) invokeCommand(sevent *slackevents.MessageEvent, text []string, response *slashResponse) {
+
 	// The command that is to be invoked should have a single word trigger and that trigger should now be at index 0 of the text slice.
 	// Lets use the string at index 0 to determine which command is being invoked.
 	// If missing is true, that means that the text at index 0 of the text slice did prompt any of the trigger funcs to return true
@@ -218,17 +285,25 @@ func (s *service) ProcessEvent(ctx context.Context, sevent *slackevents.MessageE
 	invokedCommand, missing := s.determineInvokedCommand(text[0])
 	if missing {
 		s.makeHelpMessage(Event{
-			origin: sevent,
+			origin:   sevent,
+			response: response,
 			meta: map[string]interface{}{
 				"unknown": true,
 			},
 		})
 		return
 	}
+	// Every invocation gets a context of its own so that the work it fans out can be cancelled as a whole.
+	// The context of the incoming request can't be used here, it is done as soon as Slack has been acknowledged
+	cmdCtx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
 	// Construct Internal Event to hold trigger, args, and flags
 	event := Event{
-		origin:  sevent,
-		trigger: text[0],
+		ctx:      cmdCtx,
+		origin:   sevent,
+		trigger:  text[0],
+		response: response,
 	}
 
 	// Determine if the rest of the text is long enough to be an arg or flag
@@ -238,11 +313,16 @@ func (s *service) ProcessEvent(ctx context.Context, sevent *slackevents.MessageE
 		for _, arg := range text[1:] {
 			if strings.HasPrefix(arg, "--") {
 				arg = strings.TrimPrefix(arg, "--")
-				slFlag := strings.Split(arg, "=")
-				if len(slFlag) != 2 {
+				slFlag := strings.SplitN(arg, "=", 2)
+				if slFlag[0] == "" {
 					continue
 				}
 
+				// Flags without a value, i.e. --raw, are switches
+				if len(slFlag) == 1 {
+					slFlag = append(slFlag, "true")
+				}
+
 				event.flags[slFlag[0]] = slFlag[1]
 				continue
 			}
@@ -287,6 +367,39 @@ func (s *service) determineInvokedCommand(command string) (*Command, bool) {
 
 }
 
+// splitText splits the text of a message on whitespace, keeping anything wrapped in quotes together.
+// Depending on the client, Slack may hand us curly quotes instead of straight ones
+func splitText(text string) []string {
+
+	var parts []string
+	var current strings.Builder
+	quoted, started := false, false
+
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				parts = append(parts, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+
+	if started {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+
+}
+
 // Takes a str and a slice of str and tell you if the str is in the slice
 func strInStrSlice(needle string, haystack []string) bool {
 	for _, v := range haystack {
@@ -0,0 +1,58 @@
+package slack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	nslack "github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+)
+
+// slackRecorder stands in for the Slack Web API, recording the method and body of every call
+type slackRecorder struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls []slackCall
+}
+
+type slackCall struct {
+	method string
+	form   url.Values
+	body   []byte
+}
+
+func newSlackRecorder() *slackRecorder {
+	r := &slackRecorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		form, _ := url.ParseQuery(string(body))
+
+		r.mu.Lock()
+		r.calls = append(r.calls, slackCall{method: req.URL.Path[1:], form: form, body: body})
+		r.mu.Unlock()
+
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"` + form.Get("channel") + `","ts":"1589500000.000100"}`))
+	}))
+	return r
+}
+
+func (r *slackRecorder) client() *nslack.Client {
+	return nslack.New("xoxb-test", nslack.OptionAPIURL(r.URL+"/"))
+}
+
+func (r *slackRecorder) recorded() []slackCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]slackCall(nil), r.calls...)
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
@@ -0,0 +1,127 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+)
+
+// responseURLClient posts the responses to slash commands. Slack answers quickly or not at all
+var responseURLClient = &http.Client{Timeout: time.Second * 10}
+
+const (
+	// maxRespondedFile caps the content of a file sent to a response url as a code block, Slack cuts
+	// messages longer than 4000 characters short
+	maxRespondedFile = 3500
+
+	// maxResponses and responseURLLifetime are the limits Slack puts on the response url of a slash command
+	maxResponses        = 5
+	responseURLLifetime = time.Minute * 30
+)
+
+// slashResponse is the response url of a slash command along with what is left of its budget.
+// It is shared by every reply of the command, including those made from the worker pool
+type slashResponse struct {
+	url     string
+	expires time.Time
+
+	mu   sync.Mutex
+	left int
+}
+
+func newSlashResponse(url string) *slashResponse {
+	return &slashResponse{
+		url:     url,
+		expires: time.Now().Add(responseURLLifetime),
+		left:    maxResponses,
+	}
+}
+
+// take claims a post to the response url. It returns false once Slack would refuse the post
+func (r *slashResponse) take() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.left == 0 || !time.Now().Before(r.expires) {
+		return false
+	}
+
+	r.left--
+	return true
+}
+
+// ProcessSlashCommand runs a slash command, i.e. /esi status --version=dev, through the same commands as
+// prefixed messages. The results are posted to the response url of the command
+func (s *service) ProcessSlashCommand(ctx context.Context, command nslack.SlashCommand) {
+
+	response := newSlashResponse(command.ResponseURL)
+
+	// The slash command stands in for the prefix, so the text is handled as if the prefix was already dropped
+	origin := &slackevents.MessageEvent{
+		Type:    "message",
+		Channel: command.ChannelID,
+		User:    command.UserID,
+		Text:    command.Text,
+	}
+
+	text := splitText(command.Text)
+	if len(text) == 0 {
+		s.makeHelpMessage(Event{
+			origin:   origin,
+			response: response,
+		})
+		return
+	}
+
+	s.invokeCommand(origin, text, response)
+
+}
+
+// respond posts the message to the response url of a slash command. The slack package leaves the
+// blocks out when it posts to a response url, so the message is put together here instead
+func (s *service) respond(responseURL, responseType string, options ...nslack.MsgOption) (string, string, error) {
+
+	_, values, err := nslack.UnsafeApplyMsgOptions("", "", "", options...)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to build slash command response")
+	}
+
+	msg := map[string]interface{}{
+		"response_type": responseType,
+		"text":          values.Get("text"),
+	}
+	for _, key := range []string{"blocks", "attachments"} {
+		if v := values.Get(key); v != "" {
+			msg[key] = json.RawMessage(v)
+		}
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to encode slash command response")
+	}
+
+	resp, err := responseURLClient.Post(responseURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to post slash command response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", "", fmt.Errorf("slack responded to slash command response with %d: %s", resp.StatusCode, body)
+	}
+
+	return "", "", nil
+
+}
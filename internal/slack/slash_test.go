@@ -0,0 +1,86 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eveisesi/eb2"
+	nslack "github.com/nlopes/slack"
+)
+
+// TestSlashCommandRepliesOutlastResponseURL looks up more types than a response url accepts posts for.
+// The cards that don't fit are sent through the Web API, still only visible to whoever ran the command
+func TestSlashCommandRepliesOutlastResponseURL(t *testing.T) {
+
+	const lookups = 7
+
+	fake := newFakeESI()
+	args := make([]string, 0, lookups)
+	for i := 0; i < lookups; i++ {
+		id := int64(587 + i)
+		args = append(args, strconv.FormatInt(id, 10))
+		fake.bodies[fmt.Sprintf("/latest/universe/types/%d/", id)] = &GetUniverseTypesTypeIdOk{TypeId: int32(id), Name: fmt.Sprintf("Type %d", id)}
+	}
+
+	api := newSlackRecorder()
+	defer api.Close()
+
+	s := &service{
+		logger:  newTestLogger(),
+		config:  &eb2.Config{SlackPrefixes: []string{"!esi"}},
+		goslack: api.client(),
+		esi:     fake,
+		types:   &typeIndex{names: map[int64]string{}, built: time.Now()},
+	}
+	s.commands = s.BuildCommands()
+	s.flat = s.flattenCommands(s.commands)
+
+	const responsePath = "commands/T0D4M5N6B/1114196540081/0tvQGXzNqS6b"
+	s.ProcessSlashCommand(context.Background(), nslack.SlashCommand{
+		ChannelID:   "C0ESI1234",
+		UserID:      "U0C3RZL4Z",
+		Command:     "/esi",
+		Text:        "type " + strings.Join(args, " "),
+		ResponseURL: api.URL + "/" + responsePath,
+	})
+
+	var responded, ephemeral int
+	for _, call := range api.recorded() {
+		switch call.method {
+		case responsePath:
+			responded++
+
+			var msg struct {
+				ResponseType string `json:"response_type"`
+			}
+			err := json.Unmarshal(call.body, &msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.ResponseType != nslack.ResponseTypeEphemeral {
+				t.Errorf("expected the response to be ephemeral, got %q", msg.ResponseType)
+			}
+		case "chat.postEphemeral":
+			ephemeral++
+
+			if call.form.Get("channel") != "C0ESI1234" || call.form.Get("user") != "U0C3RZL4Z" {
+				t.Errorf("expected the card to be shown to whoever ran the command, got %s %s", call.form.Get("channel"), call.form.Get("user"))
+			}
+		default:
+			t.Errorf("unexpected call to %s", call.method)
+		}
+	}
+
+	if responded != maxResponses {
+		t.Errorf("expected %d cards to be posted to the response url, got %d", maxResponses, responded)
+	}
+	if ephemeral != lookups-maxResponses {
+		t.Errorf("expected %d cards to be posted with chat.postEphemeral, got %d", lookups-maxResponses, ephemeral)
+	}
+
+}
@@ -1,16 +1,18 @@
 package slack
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/eveisesi/eb2"
+	"github.com/eveisesi/eb2/internal/esi"
 	nslack "github.com/nlopes/slack"
 	"github.com/sirupsen/logrus"
 )
@@ -48,22 +50,21 @@ func (s *service) makeEveServerStatusMessage(event Event, server string) {
 	var ok bool
 
 	if base, ok = eb2.ESI_URLS[server]; !ok {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText("Unable to determine server to fetch status for", true))
+		_, _, _ = s.reply(event, nslack.MsgOptionText("Unable to determine server to fetch status for", true))
 		return
 	}
 
 	uri, _ := url.Parse(base)
 	uri.Path = "/v1/status"
 
-	resp, err := http.Get(uri.String())
+	resp, err := s.esi.Get(event.Context(), uri.String())
 	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), true))
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), true))
 		return
 	}
 
 	title := fmt.Sprintf("%s Status", strings.Title(server))
 
-	defer resp.Body.Close()
 	var attachment nslack.Attachment
 	if resp.StatusCode > 200 {
 
@@ -88,7 +89,7 @@ func (s *service) makeEveServerStatusMessage(event Event, server string) {
 		}
 
 		s.logger.Info("Responding to request for eve server status")
-		channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionAttachments(attachment))
+		channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
 		if err != nil {
 			s.logger.WithError(err).Error("failed to respond to request for eve server status.")
 			return
@@ -101,15 +102,10 @@ func (s *service) makeEveServerStatusMessage(event Event, server string) {
 
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), true))
-		return
-	}
 	var status eb2.ServerStatus
-	err = json.Unmarshal(data, &status)
+	err = json.Unmarshal(resp.Body, &status)
 	if err != nil {
-		_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), true))
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), true))
 		return
 	}
 	color := "good"
@@ -141,7 +137,7 @@ func (s *service) makeEveServerStatusMessage(event Event, server string) {
 	}
 
 	s.logger.Info("Responding to request for eve server status")
-	channel, timestamp, err := s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionAttachments(attachment))
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
 	if err != nil {
 		s.logger.WithError(err).Error("failed to respond to request for eve server status.")
 		return
@@ -184,11 +180,10 @@ func (s *service) fetchRouteStatuses(version string) (routes []*eb2.ESIStatus, e
 
 	s.logger.WithField("req_etag", req.Header.Get("If-None-Match")).Debugln("Request Headers")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.esi.Do(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	// s.logger.WithField("status_code", resp.StatusCode).Print()
 
@@ -203,12 +198,7 @@ func (s *service) fetchRouteStatuses(version string) (routes []*eb2.ESIStatus, e
 		return nil, nil
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = json.Unmarshal(data, &routes)
+	err = json.Unmarshal(resp.Body, &routes)
 	if err != nil {
 		return nil, err
 	}
@@ -231,7 +221,7 @@ func (s *service) handleESIStatusMessage(event Event) {
 
 		routes, err := s.fetchRouteStatuses(version)
 		if err != nil {
-			_, _, _ = s.goslack.PostMessage(event.origin.Channel, nslack.MsgOptionText(err.Error(), true))
+			_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), true))
 			return
 		}
 
@@ -240,7 +230,94 @@ func (s *service) handleESIStatusMessage(event Event) {
 
 	}
 
-	s.MakeESIStatusMessage(event.origin.Channel, routes, version)
+	s.MakeESIStatusMessage(event, routes, version)
+
+}
+
+func (s *service) makeESIErrorLimitMessage(event Event) {
+
+	states := s.esi.State()
+	if len(states) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("I haven't sent any requests to ESI yet, so I don't know the error limit", false))
+		return
+	}
+
+	hosts := make([]string, 0, len(states))
+	for host := range states {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	attachments := make([]nslack.Attachment, 0, len(hosts))
+	for _, host := range hosts {
+		attachments = append(attachments, errorLimitAttachment(host, states[host]))
+	}
+
+	s.logger.Info("Responding to request for esi error limit")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachments...))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for esi error limit.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for esi error limit")
+
+}
+
+// errorLimitAttachment describes the error budget of a single ESI host
+func errorLimitAttachment(host string, state esi.State) nslack.Attachment {
+
+	remain := "Unknown"
+	resets := "Unknown"
+	color := "good"
+	if state.Known {
+		remain = fmt.Sprintf("%d (pausing at %d)", state.Remain, state.Buffer)
+		resets = "Reset"
+		if wait := time.Until(state.Reset); wait > 0 {
+			resets = fmt.Sprintf("in %ds", int(wait.Seconds()))
+		}
+		switch {
+		case state.Remain <= state.Buffer:
+			color = "danger"
+		case state.Remain <= state.Buffer*3:
+			color = "warning"
+		}
+	}
+
+	paused := "No"
+	if !state.PausedUntil.IsZero() {
+		paused = fmt.Sprintf("Yes, until %s", state.PausedUntil.Format(layoutESI))
+	}
+
+	return nslack.Attachment{
+		Color: color,
+		Title: fmt.Sprintf("ESI Error Limit (%s)", host),
+		Fields: []nslack.AttachmentField{
+			nslack.AttachmentField{
+				Title: "Errors Remaining",
+				Value: remain,
+				Short: true,
+			},
+			nslack.AttachmentField{
+				Title: "Window Resets",
+				Value: resets,
+				Short: true,
+			},
+			nslack.AttachmentField{
+				Title: "Paused",
+				Value: paused,
+				Short: true,
+			},
+			nslack.AttachmentField{
+				Title: "Requests / Retries / Pauses",
+				Value: fmt.Sprintf("%s / %s / %s", humanize.Comma(int64(state.Requests)), humanize.Comma(int64(state.Retries)), humanize.Comma(int64(state.Pauses))),
+				Short: true,
+			},
+		},
+		Fallback: fmt.Sprintf("ESI Error Limit (%s): %s remaining, resets %s", host, remain, resets),
+	}
 
 }
 
@@ -273,7 +350,7 @@ func (s *service) MakeESIMutatedRoutesMessage(channelID string, routes []string)
 
 }
 
-func (s *service) MakeESIStatusMessage(channelID string, routes []*eb2.ESIStatus, version string) {
+func (s *service) MakeESIStatusMessage(event Event, routes []*eb2.ESIStatus, version string) {
 
 	var etag string
 	etagCheck, found := s.caches["etags"].Get(version)
@@ -328,13 +405,13 @@ func (s *service) MakeESIStatusMessage(channelID string, routes []*eb2.ESIStatus
 
 	options := []nslack.MsgOption{}
 	options = append(options, nslack.MsgOptionAttachments(attachments...))
-	if channelID != s.config.SlackESIStatusChannel {
+	if event.origin.Channel != s.config.SlackESIStatusChannel {
 		msg := fmt.Sprintf("Psst.....Checkout <#%s> for a continuous feed of statuses from me...", s.config.SlackESIStatusChannel)
 		options = append(options, nslack.MsgOptionText(msg, false))
 	}
 
 	s.logger.Info("Responding to request for esi route status.")
-	channel, timestamp, err := s.goslack.PostMessage(channelID, options...)
+	channel, timestamp, err := s.reply(event, options...)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to respond to request for esi route status.")
 		return
@@ -386,3 +463,68 @@ func generateRoutesString(routes []*eb2.ESIStatus) string {
 
 	return fmt.Sprintf("```%s```", strings.Join(t, "\n"))
 }
+
+func (s *service) makeGithubRateLimitMessage(event Event) {
+
+	state := s.github.state()
+
+	color := "good"
+	fields := make([]nslack.AttachmentField, 0, 4)
+	for _, category := range []string{githubRateCore, githubRateSearch} {
+		rate := state.Rates[category]
+
+		remain := "Unknown"
+		if rate.Known {
+			remain = fmt.Sprintf("%d of %d", rate.Remaining, rate.Limit)
+			if wait := time.Until(rate.Reset); wait > 0 {
+				remain = fmt.Sprintf("%s, resets in %s", remain, wait.Round(time.Second))
+			}
+			if category == githubRateCore && rate.Remaining <= state.Buffer && time.Now().Before(rate.Reset) {
+				color = "danger"
+			}
+		}
+
+		fields = append(fields, nslack.AttachmentField{
+			Title: fmt.Sprintf("%s Requests Remaining", strings.Title(category)),
+			Value: remain,
+			Short: true,
+		})
+	}
+
+	authenticated := "No, set GITHUB_TOKEN for a higher limit"
+	if state.Authenticated {
+		authenticated = "Yes"
+	}
+
+	fields = append(fields,
+		nslack.AttachmentField{
+			Title: "Authenticated",
+			Value: authenticated,
+			Short: true,
+		},
+		nslack.AttachmentField{
+			Title: "Requests / Revalidated",
+			Value: fmt.Sprintf("%s / %s", humanize.Comma(int64(state.Requests)), humanize.Comma(int64(state.Revalidated))),
+			Short: true,
+		},
+	)
+
+	attachment := nslack.Attachment{
+		Color:    color,
+		Title:    "Github Rate Limit",
+		Fields:   fields,
+		Fallback: fmt.Sprintf("Github Rate Limit: %s", fields[0].Value),
+	}
+
+	s.logger.Info("Responding to request for github rate limit")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for github rate limit.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for github rate limit")
+
+}
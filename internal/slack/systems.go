@@ -0,0 +1,239 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	nslack "github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+)
+
+// systemLookupWorkers caps the number of calls made at the same time while building the system card
+const systemLookupWorkers = 4
+
+type GetUniverseSystemsSystemIdOk struct {
+	ConstellationId int32                               `json:"constellation_id,omitempty"`
+	Name            string                              `json:"name,omitempty"`
+	Planets         []*GetUniverseSystemsSystemIdPlanet `json:"planets,omitempty"`
+	SecurityClass   string                              `json:"security_class,omitempty"`
+	SecurityStatus  float64                             `json:"security_status,omitempty"`
+	StarId          int32                               `json:"star_id,omitempty"`
+	Stargates       []int32                             `json:"stargates,omitempty"`
+	Stations        []int32                             `json:"stations,omitempty"`
+	SystemId        int32                               `json:"system_id,omitempty"`
+}
+
+type GetUniverseSystemsSystemIdPlanet struct {
+	AsteroidBelts []int32 `json:"asteroid_belts,omitempty"`
+	Moons         []int32 `json:"moons,omitempty"`
+	PlanetId      int32   `json:"planet_id,omitempty"`
+}
+
+type GetUniverseConstellationsConstellationIdOk struct {
+	Name     string `json:"name,omitempty"`
+	RegionId int32  `json:"region_id,omitempty"`
+}
+
+type GetUniverseRegionsRegionIdOk struct {
+	Name string `json:"name,omitempty"`
+}
+
+type GetUniverseStarsStarIdOk struct {
+	Name          string `json:"name,omitempty"`
+	SpectralClass string `json:"spectral_class,omitempty"`
+}
+
+type GetSovereigntyMap200Ok struct {
+	AllianceId    int32 `json:"alliance_id,omitempty"`
+	CorporationId int32 `json:"corporation_id,omitempty"`
+	FactionId     int32 `json:"faction_id,omitempty"`
+	SystemId      int32 `json:"system_id,omitempty"`
+}
+
+type GetUniverseSystemJumps200Ok struct {
+	ShipJumps int64 `json:"ship_jumps"`
+	SystemId  int32 `json:"system_id"`
+}
+
+type GetUniverseSystemKills200Ok struct {
+	NpcKills  int64 `json:"npc_kills"`
+	PodKills  int64 `json:"pod_kills"`
+	ShipKills int64 `json:"ship_kills"`
+	SystemId  int32 `json:"system_id"`
+}
+
+// roundSecurity rounds the security status the way the client displays it. Systems that would
+// round down to 0.0 while still being low sec are shown as 0.1
+func roundSecurity(sec float64) float64 {
+	if sec > 0 && sec < 0.05 {
+		return 0.1
+	}
+
+	return math.Round(sec*10) / 10
+}
+
+// securityBand returns the name and the attachment color of the security band the system is in
+func securityBand(sec float64) (string, string) {
+	switch rounded := roundSecurity(sec); {
+	case rounded >= 0.5:
+		return "high sec", "good"
+	case rounded > 0:
+		return "low sec", "warning"
+	}
+
+	return "null sec", "danger"
+}
+
+func (s *service) makeSystemMessage(event Event) {
+
+	if len(event.args) == 0 {
+		_, _, _ = s.reply(event, nslack.MsgOptionText("You need to supply the name or id of a solar system", false))
+		return
+	}
+
+	ctx := event.Context()
+
+	server, err := serverFromEvent(event)
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	systemID, _, err := s.resolveID(ctx, server, strings.Join(event.args, " "), "solar_system")
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(err.Error(), false))
+		return
+	}
+
+	var system GetUniverseSystemsSystemIdOk
+	if !s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v4/universe/systems/%d/", systemID), nil), &system) {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("Unable to fetch solar system %d from esi", systemID), false))
+		return
+	}
+
+	var (
+		constellation GetUniverseConstellationsConstellationIdOk
+		region        GetUniverseRegionsRegionIdOk
+		star          GetUniverseStarsStarIdOk
+		sovereignty   []*GetSovereigntyMap200Ok
+		jumps         []*GetUniverseSystemJumps200Ok
+		kills         []*GetUniverseSystemKills200Ok
+	)
+
+	// Each job decodes into a variable of its own so they can safely run side by side
+	pool := newWorkerPool(ctx, systemLookupWorkers)
+	pool.Go(func(ctx context.Context) {
+		if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/universe/constellations/%d/", system.ConstellationId), nil), &constellation) {
+			s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/universe/regions/%d/", constellation.RegionId), nil), &region)
+		}
+	})
+	pool.Go(func(ctx context.Context) {
+		if system.StarId != 0 {
+			s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/universe/stars/%d/", system.StarId), nil), &star)
+		}
+	})
+	pool.Go(func(ctx context.Context) {
+		s.getESIJSON(ctx, esiURL(server, "/v1/sovereignty/map/", nil), &sovereignty)
+	})
+	pool.Go(func(ctx context.Context) {
+		s.getESIJSON(ctx, esiURL(server, "/v1/universe/system_jumps/", nil), &jumps)
+	})
+	pool.Go(func(ctx context.Context) {
+		s.getESIJSON(ctx, esiURL(server, "/v2/universe/system_kills/", nil), &kills)
+	})
+
+	err = pool.Wait()
+	if err != nil {
+		_, _, _ = s.reply(event, nslack.MsgOptionText(fmt.Sprintf("I gave up on looking up %s: %s", system.Name, err.Error()), false))
+		return
+	}
+
+	sov := "None"
+	for _, entry := range sovereignty {
+		if entry.SystemId != system.SystemId {
+			continue
+		}
+
+		holder := int64(entry.AllianceId)
+		if holder == 0 {
+			holder = int64(entry.FactionId)
+		}
+		if holder == 0 {
+			break
+		}
+
+		sov = fmt.Sprintf("%d", holder)
+		names, err := s.resolveNames(ctx, server, []int64{holder})
+		if err == nil && len(names) == 1 {
+			sov = names[0].Name
+		}
+		break
+	}
+
+	// Systems without any activity in the last hour are left out of the jumps and kills lists
+	var shipJumps int64
+	for _, entry := range jumps {
+		if entry.SystemId == system.SystemId {
+			shipJumps = entry.ShipJumps
+			break
+		}
+	}
+
+	var systemKills GetUniverseSystemKills200Ok
+	for _, entry := range kills {
+		if entry.SystemId == system.SystemId {
+			systemKills = *entry
+			break
+		}
+	}
+
+	moons, belts := 0, 0
+	for _, planet := range system.Planets {
+		moons += len(planet.Moons)
+		belts += len(planet.AsteroidBelts)
+	}
+
+	starText := "-"
+	if star.Name != "" {
+		starText = fmt.Sprintf("%s (%s)", star.Name, star.SpectralClass)
+	}
+
+	band, color := securityBand(system.SecurityStatus)
+
+	attachment := nslack.Attachment{
+		Color: color,
+		Title: fmt.Sprintf("%s (%d)", system.Name, system.SystemId),
+		Fields: []nslack.AttachmentField{
+			{Title: "Security", Value: fmt.Sprintf("%.1f (%s, %.3f)", roundSecurity(system.SecurityStatus), band, system.SecurityStatus), Short: true},
+			{Title: "Sovereignty", Value: sov, Short: true},
+			{Title: "Constellation", Value: valueOrDash(constellation.Name), Short: true},
+			{Title: "Region", Value: valueOrDash(region.Name), Short: true},
+			{Title: "Star", Value: starText, Short: true},
+			{Title: "Planets / Moons / Belts", Value: fmt.Sprintf("%d / %d / %d", len(system.Planets), moons, belts), Short: true},
+			{Title: "Stations", Value: fmt.Sprintf("%d", len(system.Stations)), Short: true},
+			{Title: "Stargates", Value: fmt.Sprintf("%d", len(system.Stargates)), Short: true},
+			{Title: "Jumps (last hour)", Value: humanize.Comma(shipJumps), Short: true},
+			{
+				Title: "Kills (last hour)",
+				Value: fmt.Sprintf("%s ships / %s pods / %s npcs", humanize.Comma(systemKills.ShipKills), humanize.Comma(systemKills.PodKills), humanize.Comma(systemKills.NpcKills)),
+				Short: true,
+			},
+		},
+		Fallback: fmt.Sprintf("%s: %.1f security in %s", system.Name, roundSecurity(system.SecurityStatus), region.Name),
+	}
+
+	s.logger.Info("Responding to request for solar system")
+	channel, timestamp, err := s.reply(event, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to respond to request for solar system.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully responded to request for solar system")
+
+}
@@ -0,0 +1,178 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	nslack "github.com/nlopes/slack"
+)
+
+const (
+	imageServer = "https://images.evetech.net"
+
+	// categoryShip is the category id of ships, which have renders on the image server instead of icons
+	categoryShip = 6
+
+	// maxCardAttributes caps the number of dogma attributes listed on a type card
+	maxCardAttributes  = 25
+	maxCardDescription = 300
+)
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+type GetUniverseGroupsGroupIdOk struct {
+	Name       string `json:"name,omitempty"`
+	CategoryId int32  `json:"category_id,omitempty"`
+}
+
+type GetUniverseCategoriesCategoryIdOk struct {
+	Name string `json:"name,omitempty"`
+}
+
+type GetMarketsGroupsMarketGroupIdOk struct {
+	Name string `json:"name,omitempty"`
+}
+
+// typeMeta holds the names of the groups a type belongs to
+type typeMeta struct {
+	group       string
+	category    string
+	categoryID  int32
+	marketGroup string
+}
+
+// fetchTypeMeta resolves the group, category and market group of the type. Lookups that
+// fail are left empty so that the card can still be rendered. It returns the number of calls made to esi
+func (s *service) fetchTypeMeta(ctx context.Context, server string, tp *GetUniverseTypesTypeIdOk) (typeMeta, int) {
+
+	var meta typeMeta
+	calls := 0
+
+	var group GetUniverseGroupsGroupIdOk
+	calls++
+	if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/universe/groups/%d/", tp.GroupId), nil), &group) {
+		meta.group = group.Name
+		meta.categoryID = group.CategoryId
+
+		var category GetUniverseCategoriesCategoryIdOk
+		calls++
+		if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/universe/categories/%d/", group.CategoryId), nil), &category) {
+			meta.category = category.Name
+		}
+	}
+
+	if tp.MarketGroupId != 0 {
+		var marketGroup GetMarketsGroupsMarketGroupIdOk
+		calls++
+		if s.getESIJSON(ctx, esiURL(server, fmt.Sprintf("/v1/markets/groups/%d/", tp.MarketGroupId), nil), &marketGroup) {
+			meta.marketGroup = marketGroup.Name
+		}
+	}
+
+	return meta, calls
+
+}
+
+// getESIJSON decodes a successful response into out, reporting whether it managed to
+func (s *service) getESIJSON(ctx context.Context, uri string, out interface{}) bool {
+	resp, err := s.esi.Get(ctx, uri)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	return json.Unmarshal(resp.Body, out) == nil
+}
+
+func typeImageURL(tp *GetUniverseTypesTypeIdOk, meta typeMeta) string {
+	if meta.categoryID == categoryShip {
+		return fmt.Sprintf("%s/types/%d/render?size=128", imageServer, tp.TypeId)
+	}
+
+	return fmt.Sprintf("%s/types/%d/icon?size=64", imageServer, tp.TypeId)
+}
+
+// buildTypeCard renders the type as Block Kit blocks with the dogma attributes in an attachment
+// of their own, which Slack collapses behind a "Show more" when the list is long
+func buildTypeCard(tp *GetUniverseTypesTypeIdOk, meta typeMeta, summary string) ([]nslack.Block, []nslack.Attachment) {
+
+	description := strings.TrimSpace(htmlTags.ReplaceAllString(tp.Description, ""))
+	if runes := []rune(description); len(runes) > maxCardDescription {
+		description = strings.TrimSpace(string(runes[:maxCardDescription])) + "…"
+	}
+
+	heading := fmt.Sprintf("*%s* (%d)", tp.Name, tp.TypeId)
+	if description != "" {
+		heading = fmt.Sprintf("%s\n%s", heading, description)
+	}
+
+	field := func(title, value string) *nslack.TextBlockObject {
+		return nslack.NewTextBlockObject(nslack.MarkdownType, fmt.Sprintf("*%s*\n%s", title, valueOrDash(value)), false, false)
+	}
+
+	fields := []*nslack.TextBlockObject{
+		field("Group", meta.group),
+		field("Category", meta.category),
+		field("Market Group", meta.marketGroup),
+		field("Volume", fmt.Sprintf("%s m³", humanize.CommafWithDigits(float64(tp.Volume), 2))),
+		field("Mass", fmt.Sprintf("%s kg", humanize.CommafWithDigits(float64(tp.Mass), 2))),
+		field("Capacity", fmt.Sprintf("%s m³", humanize.CommafWithDigits(float64(tp.Capacity), 2))),
+	}
+
+	if tp.PackagedVolume != 0 && tp.PackagedVolume != tp.Volume {
+		fields = append(fields, field("Packaged Volume", fmt.Sprintf("%s m³", humanize.CommafWithDigits(float64(tp.PackagedVolume), 2))))
+	}
+
+	blocks := []nslack.Block{
+		nslack.NewSectionBlock(
+			nslack.NewTextBlockObject(nslack.MarkdownType, heading, false, false),
+			nil,
+			nslack.NewAccessory(nslack.NewImageBlockElement(typeImageURL(tp, meta), tp.Name)),
+		),
+		nslack.NewSectionBlock(nil, fields, nil),
+		nslack.NewContextBlock("", nslack.NewTextBlockObject(nslack.MarkdownType, summary, false, false)),
+	}
+
+	var lines []string
+	total := 0
+	for _, attr := range tp.DogmaAttributes {
+		if !attr.Published || attr.DisplayName == "" {
+			continue
+		}
+
+		total++
+		if len(lines) < maxCardAttributes {
+			lines = append(lines, fmt.Sprintf("%s: %s", attr.DisplayName, formatDogmaValue(float64(attr.Value), attr.UnitId)))
+		}
+	}
+
+	if total == 0 {
+		return blocks, nil
+	}
+
+	if total > len(lines) {
+		lines = append(lines, fmt.Sprintf("and %d more, use --raw for everything", total-len(lines)))
+	}
+
+	attachments := []nslack.Attachment{
+		{
+			Title:    fmt.Sprintf("Dogma Attributes (%d)", total),
+			Text:     fmt.Sprintf("```%s```", strings.Join(lines, "\n")),
+			Fallback: fmt.Sprintf("%d dogma attributes", total),
+		},
+	}
+
+	return blocks, attachments
+
+}
+
+func valueOrDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
@@ -0,0 +1,230 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eveisesi/eb2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// typeIndexTTL is how long the type name index is used before it is rebuilt
+	typeIndexTTL = time.Hour * 24
+
+	// maxTypeCandidates caps the number of types listed when a name is ambiguous
+	maxTypeCandidates = 10
+)
+
+// typeIndex holds the name of every type on Tranquility so that types can be looked
+// up by partial names. ESI only resolves exact names through /universe/ids
+type typeIndex struct {
+	mu       sync.RWMutex
+	names    map[int64]string
+	built    time.Time
+	building bool
+}
+
+func (i *typeIndex) stale() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return !i.building && time.Since(i.built) > typeIndexTTL
+}
+
+func (i *typeIndex) ready() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.names != nil
+}
+
+// search returns the types whose name contains the term. Exact matches are ranked
+// first, then names starting with the term, then names with a word starting with
+// the term, with shorter names winning ties
+func (i *typeIndex) search(term string) []*UniverseName {
+
+	term = strings.ToLower(term)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	type match struct {
+		name *UniverseName
+		rank int
+	}
+
+	var matches []match
+	for id, name := range i.names {
+		lower := strings.ToLower(name)
+		if !strings.Contains(lower, term) {
+			continue
+		}
+
+		rank := 3
+		switch {
+		case lower == term:
+			rank = 0
+		case strings.HasPrefix(lower, term):
+			rank = 1
+		case strings.Contains(lower, " "+term):
+			rank = 2
+		}
+
+		matches = append(matches, match{
+			name: &UniverseName{ID: id, Name: name, Category: "inventory_type"},
+			rank: rank,
+		})
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].rank != matches[b].rank {
+			return matches[a].rank < matches[b].rank
+		}
+		if len(matches[a].name.Name) != len(matches[b].name.Name) {
+			return len(matches[a].name.Name) < len(matches[b].name.Name)
+		}
+		return matches[a].name.ID < matches[b].name.ID
+	})
+
+	results := make([]*UniverseName, len(matches))
+	for k, m := range matches {
+		results[k] = m.name
+	}
+
+	return results
+
+}
+
+// refreshTypeIndex rebuilds the type name index from /universe/types and /universe/names
+func (s *service) refreshTypeIndex() {
+
+	s.types.mu.Lock()
+	if s.types.building {
+		s.types.mu.Unlock()
+		return
+	}
+	s.types.building = true
+	s.types.mu.Unlock()
+
+	defer func() {
+		s.types.mu.Lock()
+		s.types.building = false
+		s.types.mu.Unlock()
+	}()
+
+	start := time.Now()
+	names, err := s.fetchTypeNames(context.Background())
+	if err != nil {
+		s.logger.WithError(err).Error("failed to build type name index")
+		return
+	}
+
+	s.types.mu.Lock()
+	s.types.names = names
+	s.types.built = time.Now()
+	s.types.mu.Unlock()
+
+	s.logger.WithField("types", len(names)).WithField("took", time.Since(start).String()).Info("built type name index")
+
+}
+
+func (s *service) fetchTypeNames(ctx context.Context) (map[int64]string, error) {
+
+	var ids []int64
+	for page, pages := 1, 1; page <= pages; page++ {
+		query := url.Values{}
+		query.Set("page", strconv.Itoa(page))
+
+		resp, err := s.esi.Get(ctx, esiURL(eb2.ESI_TRANQUILITY, "/v1/universe/types/", query))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch page %d of /universe/types. esi responded with %d: %s", page, resp.StatusCode, esiErrorMessage(resp.Body))
+		}
+
+		var chunk []int64
+		err = json.Unmarshal(resp.Body, &chunk)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode page %d of /universe/types", page)
+		}
+
+		ids = append(ids, chunk...)
+
+		if p, err := strconv.Atoi(resp.Header.Get("X-Pages")); err == nil {
+			pages = p
+		}
+	}
+
+	names := make(map[int64]string, len(ids))
+	for start := 0; start < len(ids); start += maxNamesPerRequest {
+		end := start + maxNamesPerRequest
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		resolved, err := s.resolveNames(ctx, eb2.ESI_TRANQUILITY, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range resolved {
+			names[name.ID] = name.Name
+		}
+	}
+
+	return names, nil
+
+}
+
+// resolveType turns the argument of a type lookup into a type id. Numeric arguments are used as is,
+// otherwise the argument is resolved by its exact name and then by searching the type name index.
+// When the argument matches more than one type, the best candidates are returned instead of an id
+func (s *service) resolveType(ctx context.Context, server, arg string) (int64, []*UniverseName, error) {
+
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id, nil, nil
+	}
+
+	exact, err := s.resolveIDs(ctx, server, []string{arg})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, name := range exact {
+		if name.Category == "inventory_type" {
+			return name.ID, nil, nil
+		}
+	}
+
+	if server != eb2.ESI_TRANQUILITY {
+		return 0, nil, fmt.Errorf("unable to find a type named %s on %s", arg, strings.Title(server))
+	}
+
+	if !s.types.ready() {
+		return 0, nil, fmt.Errorf("unable to find a type named %s. I'm still indexing type names for partial matches, try again in a minute", arg)
+	}
+
+	matches := s.types.search(arg)
+	switch {
+	case len(matches) == 0:
+		return 0, nil, fmt.Errorf("unable to find a type matching %s", arg)
+	case len(matches) == 1:
+		return matches[0].ID, nil, nil
+	case len(matches) > maxTypeCandidates:
+		matches = matches[:maxTypeCandidates]
+	}
+
+	return 0, matches, nil
+
+}
@@ -0,0 +1,192 @@
+package slack
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/eveisesi/eb2"
+	nslack "github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxOfferedRequests caps the number of esi links a single message gets a button for
+	maxOfferedRequests = 3
+
+	actionRunESIRequest = "esi_request_run"
+)
+
+var linkRe = regexp.MustCompile(`https?://[^\s<>|]+`)
+
+// esiLink is a request to esi found in a message. The path includes the version and any query string
+type esiLink struct {
+	server string
+	path   string
+}
+
+// unfurl looks for killmails and esi requests in messages that weren't addressed to the bot
+func (s *service) unfurl(sevent *slackevents.MessageEvent) {
+
+	// Replies of the bot link to zKillboard and ESI, so its own messages would otherwise be unfurled forever
+	if sevent.BotID != "" || sevent.SubType != "" {
+		return
+	}
+
+	s.unfurlKillmails(sevent)
+	s.offerESIRequests(sevent)
+
+}
+
+// offerESIRequests replies in-thread with a button for every valid esi request linked in the message.
+// This only happens in the channels configured with SLACK_UNFURL_CHANNELS
+func (s *service) offerESIRequests(sevent *slackevents.MessageEvent) {
+
+	if !strInStrSlice(sevent.Channel, s.config.SlackUnfurlChannels) {
+		return
+	}
+
+	links := s.findESILinks(sevent.Text)
+	if len(links) == 0 {
+		return
+	}
+
+	ts := sevent.ThreadTimeStamp
+	if ts == "" {
+		ts = sevent.TimeStamp
+	}
+
+	// Every link gets a message of its own so that running one request only replaces its own button
+	for _, link := range links {
+		text := nslack.NewTextBlockObject(nslack.MarkdownType, fmt.Sprintf("That looks like a request to ESI, want me to run `GET %s` on %s?", link.path, strings.Title(link.server)), false, false)
+		button := nslack.NewButtonBlockElement(actionRunESIRequest, link.server+" "+link.path, nslack.NewTextBlockObject(nslack.PlainTextType, "Run it", false, false))
+
+		s.logger.Info("Responding to esi link")
+		channel, timestamp, err := s.goslack.PostMessage(
+			sevent.Channel,
+			nslack.MsgOptionTS(ts),
+			nslack.MsgOptionText(text.Text, false),
+			nslack.MsgOptionBlocks(nslack.NewSectionBlock(text, nil, nslack.NewAccessory(button))),
+		)
+		if err != nil {
+			s.logger.WithError(err).Error("failed to respond to esi link.")
+			return
+		}
+		s.logger.WithFields(logrus.Fields{
+			"channel":   channel,
+			"timestamp": timestamp,
+		}).Info("successfully responded to esi link")
+	}
+
+}
+
+// findESILinks returns the links in the text that point at a GET route of the servers spec
+func (s *service) findESILinks(text string) []esiLink {
+
+	hosts := make(map[string]string, len(eb2.ESI_URLS))
+	for server, base := range eb2.ESI_URLS {
+		uri, err := url.Parse(base)
+		if err != nil {
+			continue
+		}
+		hosts[uri.Host] = server
+	}
+
+	var links []esiLink
+	seen := make(map[string]bool)
+
+	// Slack escapes &, < and > in the text of messages, which would otherwise end up in the query string
+	for _, match := range linkRe.FindAllString(html.UnescapeString(text), -1) {
+		uri, err := url.Parse(match)
+		if err != nil {
+			continue
+		}
+
+		server, ok := hosts[uri.Host]
+		if !ok {
+			continue
+		}
+
+		query := uri.Query()
+		if ds := strings.ToLower(query.Get("datasource")); ds != "" {
+			if _, ok := eb2.ESI_URLS[ds]; ok {
+				server = ds
+			}
+		}
+		query.Del("datasource")
+
+		routes, err := s.routeIndex(server)
+		if err != nil {
+			s.logger.WithError(err).Error("failed to load route index for esi link")
+			continue
+		}
+
+		path, valid := validateRoute(uri.Path, routes)
+		if !valid {
+			continue
+		}
+		if len(query) > 0 {
+			path = fmt.Sprintf("%s?%s", path, query.Encode())
+		}
+
+		if seen[server+path] {
+			continue
+		}
+		seen[server+path] = true
+
+		links = append(links, esiLink{server: server, path: path})
+		if len(links) == maxOfferedRequests {
+			break
+		}
+	}
+
+	return links
+
+}
+
+// runOfferedESIRequest runs the request behind a button posted by offerESIRequests, posting the result to the same thread
+func (s *service) runOfferedESIRequest(callback Interaction) {
+
+	action := callback.Action()
+	parts := strings.SplitN(action.Value, " ", 2)
+	if len(parts) != 2 {
+		s.logger.WithField("value", action.Value).Error("received esi request button with an invalid value")
+		return
+	}
+
+	server, path := parts[0], parts[1]
+
+	ts := callback.Message.ThreadTimestamp
+	if ts == "" {
+		ts = callback.Message.Timestamp
+	}
+
+	// Replace the button so that the request isn't run again for everybody in the thread
+	text := fmt.Sprintf("<@%s> ran `GET %s` on %s", callback.User.ID, path, strings.Title(server))
+	_, _, _, err := s.goslack.UpdateMessage(
+		callback.Channel.ID,
+		callback.Message.Timestamp,
+		nslack.MsgOptionText(text, false),
+		nslack.MsgOptionBlocks(nslack.NewSectionBlock(nslack.NewTextBlockObject(nslack.MarkdownType, text, false, false), nil, nil)),
+	)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to update esi request buttons")
+	}
+
+	s.makeESIDynamicRequestMessage(Event{
+		ctx: callback.Context(),
+		origin: &slackevents.MessageEvent{
+			Channel:         callback.Channel.ID,
+			User:            callback.User.ID,
+			ThreadTimeStamp: ts,
+		},
+		trigger: path,
+		flags: map[string]string{
+			"server": server,
+		},
+	})
+
+}
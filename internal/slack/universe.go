@@ -0,0 +1,152 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxNamesPerRequest and maxIDsPerRequest are the limits ESI puts on the body of
+	// POST /universe/names and POST /universe/ids respectively
+	maxNamesPerRequest = 1000
+	maxIDsPerRequest   = 500
+)
+
+type UniverseName struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// idCategories maps the keys of the /universe/ids response onto the categories
+// /universe/names uses so that both lookups can be rendered the same way
+var idCategories = map[string]string{
+	"agents":          "agent",
+	"alliances":       "alliance",
+	"characters":      "character",
+	"constellations":  "constellation",
+	"corporations":    "corporation",
+	"factions":        "faction",
+	"inventory_types": "inventory_type",
+	"regions":         "region",
+	"stations":        "station",
+	"systems":         "solar_system",
+}
+
+// resolveNames resolves ids to names using POST /universe/names. ESI rejects the entire
+// request when any one of the ids is invalid
+func (s *service) resolveNames(ctx context.Context, server string, ids []int64) ([]*UniverseName, error) {
+
+	if len(ids) > maxNamesPerRequest {
+		return nil, fmt.Errorf("a maximum of %d ids can be resolved at once", maxNamesPerRequest)
+	}
+
+	resp, err := s.esi.Post(ctx, esiURL(server, "/v3/universe/names/", nil), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to resolve ids to names. esi responded with %d: %s", resp.StatusCode, esiErrorMessage(resp.Body))
+	}
+
+	var names []*UniverseName
+	err = json.Unmarshal(resp.Body, &names)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode response from /universe/names")
+	}
+
+	return names, nil
+
+}
+
+// resolveIDs resolves names to ids using POST /universe/ids. Names that ESI can not
+// match are left out of the result
+func (s *service) resolveIDs(ctx context.Context, server string, names []string) ([]*UniverseName, error) {
+
+	if len(names) > maxIDsPerRequest {
+		return nil, fmt.Errorf("a maximum of %d names can be resolved at once", maxIDsPerRequest)
+	}
+
+	resp, err := s.esi.Post(ctx, esiURL(server, "/v1/universe/ids/", nil), names)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to resolve names to ids. esi responded with %d: %s", resp.StatusCode, esiErrorMessage(resp.Body))
+	}
+
+	var grouped map[string][]*UniverseName
+	err = json.Unmarshal(resp.Body, &grouped)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode response from /universe/ids")
+	}
+
+	var resolved []*UniverseName
+	for key, entries := range grouped {
+		category, ok := idCategories[key]
+		if !ok {
+			category = key
+		}
+		for _, entry := range entries {
+			entry.Category = category
+			resolved = append(resolved, entry)
+		}
+	}
+
+	sort.Slice(resolved, func(i, j int) bool {
+		if resolved[i].Category != resolved[j].Category {
+			return resolved[i].Category < resolved[j].Category
+		}
+		return resolved[i].ID < resolved[j].ID
+	})
+
+	return resolved, nil
+
+}
+
+// resolveID turns an argument into the id of an entity in the category, i.e. solar_system or character.
+// Numeric arguments are used as is, anything else is resolved by its exact name. The name of the entity
+// is returned along with its id when it is known
+func (s *service) resolveID(ctx context.Context, server, arg, category string) (int64, string, error) {
+
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id, "", nil
+	}
+
+	resolved, err := s.resolveIDs(ctx, server, []string{arg})
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, name := range resolved {
+		if name.Category == category {
+			return name.ID, name.Name, nil
+		}
+	}
+
+	return 0, "", fmt.Errorf("unable to find a %s named %s", strings.Replace(category, "_", " ", -1), arg)
+
+}
+
+// esiErrorMessage pulls the error field out of an ESI error body, falling back to the raw body
+func esiErrorMessage(body []byte) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+
+	err := json.Unmarshal(body, &e)
+	if err != nil || e.Error == "" {
+		return strings.TrimSpace(string(body))
+	}
+
+	return e.Error
+}
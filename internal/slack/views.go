@@ -0,0 +1,101 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	nslack "github.com/nlopes/slack"
+)
+
+// InteractionTypeViewSubmission is sent by Slack when a modal is submitted. The slack package predates modals so it is declared here
+const InteractionTypeViewSubmission = nslack.InteractionType("view_submission")
+
+// View is the modal a view_submission was sent for
+type View struct {
+	ID              string    `json:"id"`
+	CallbackID      string    `json:"callback_id"`
+	PrivateMetadata string    `json:"private_metadata"`
+	State           ViewState `json:"state"`
+}
+
+// ViewState holds the values of the inputs of a modal, keyed by block_id and then action_id
+type ViewState struct {
+	Values map[string]map[string]ViewStateValue `json:"values"`
+}
+
+type ViewStateValue struct {
+	Type           string                    `json:"type"`
+	Value          string                    `json:"value"`
+	SelectedOption *nslack.OptionBlockObject `json:"selected_option,omitempty"`
+}
+
+// modalView is a modal as it is sent to views.open. The slack package has no support for modals
+// and their input blocks, so the few parts that are needed are declared here
+type modalView struct {
+	Type            string                  `json:"type"`
+	CallbackID      string                  `json:"callback_id"`
+	PrivateMetadata string                  `json:"private_metadata,omitempty"`
+	Title           *nslack.TextBlockObject `json:"title"`
+	Submit          *nslack.TextBlockObject `json:"submit,omitempty"`
+	Close           *nslack.TextBlockObject `json:"close,omitempty"`
+	Blocks          []interface{}           `json:"blocks"`
+}
+
+type inputBlock struct {
+	Type     string                  `json:"type"`
+	BlockID  string                  `json:"block_id"`
+	Label    *nslack.TextBlockObject `json:"label"`
+	Element  plainTextInput          `json:"element"`
+	Optional bool                    `json:"optional,omitempty"`
+}
+
+type plainTextInput struct {
+	Type         string                  `json:"type"`
+	ActionID     string                  `json:"action_id"`
+	Placeholder  *nslack.TextBlockObject `json:"placeholder,omitempty"`
+	InitialValue string                  `json:"initial_value,omitempty"`
+	Multiline    bool                    `json:"multiline,omitempty"`
+}
+
+// openView opens the modal in response to the interaction the trigger id was sent with
+func (s *service) openView(ctx context.Context, triggerID string, view modalView) error {
+
+	data, err := json.Marshal(map[string]interface{}{
+		"trigger_id": triggerID,
+		"view":       view,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode view")
+	}
+
+	uri := strings.TrimSuffix(s.config.SlackAPIURL, "/") + "/views.open"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to build views.open request")
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.SlackAPIToken)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to call views.open")
+	}
+	defer resp.Body.Close()
+
+	var result nslack.SlackResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode views.open response")
+	}
+	if !result.Ok {
+		return errors.Errorf("views.open failed: %s", result.Error)
+	}
+
+	return nil
+
+}
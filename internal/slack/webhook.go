@@ -0,0 +1,91 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/sirupsen/logrus"
+
+	nslack "github.com/nlopes/slack"
+)
+
+// ProcessGithubEvent posts an event received through the Github webhook. Events are posted to the channel
+// configured for their type in GITHUB_WEBHOOK_CHANNELS, falling back to the feed channel. The context bounds the post to Slack
+func (s *service) ProcessGithubEvent(ctx context.Context, eventType string, payload interface{}) {
+
+	attachment, ok := githubEventAttachment(payload)
+	if !ok {
+		return
+	}
+
+	channel, ok := s.config.GithubWebhookChannels[eventType]
+	if !ok || channel == "" {
+		channel = s.config.GithubFeedChannel
+	}
+	if channel == "" {
+		s.logger.WithField("event", eventType).Warn("no channel is configured for github event")
+		return
+	}
+
+	s.logger.WithField("event", eventType).Info("Posting github event")
+	channel, timestamp, err := s.goslack.PostMessageContext(ctx, channel, nslack.MsgOptionAttachments(attachment))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to post github event.")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"channel":   channel,
+		"timestamp": timestamp,
+	}).Info("successfully posted github event")
+
+}
+
+// githubEventAttachment renders a webhook payload as parsed by github.ParseWebHook. Only issues, issue_comment
+// and release events are rendered, false is returned for everything else
+func githubEventAttachment(payload interface{}) (nslack.Attachment, bool) {
+
+	switch p := payload.(type) {
+	case *github.IssuesEvent:
+		return issueActivityAttachment(p.GetRepo().GetFullName(), p.GetAction(), p.Issue, p.Sender, p.Label, nil)
+	case *github.IssueCommentEvent:
+		return issueActivityAttachment(p.GetRepo().GetFullName(), p.GetAction(), p.Issue, p.Sender, nil, p.Comment)
+	case *github.ReleaseEvent:
+		return releaseAttachment(p)
+	}
+
+	return nslack.Attachment{}, false
+
+}
+
+func releaseAttachment(event *github.ReleaseEvent) (nslack.Attachment, bool) {
+
+	if event.GetAction() != "published" || event.Release == nil {
+		return nslack.Attachment{}, false
+	}
+
+	release := event.Release
+
+	name := release.GetName()
+	if name == "" {
+		name = release.GetTagName()
+	}
+
+	pretext := "New release"
+	if release.GetPrerelease() {
+		pretext = "New pre-release"
+	}
+
+	return nslack.Attachment{
+		Color:      "#6f42c1",
+		Pretext:    pretext,
+		AuthorName: release.GetAuthor().GetLogin(),
+		AuthorLink: release.GetAuthor().GetHTMLURL(),
+		AuthorIcon: release.GetAuthor().GetAvatarURL(),
+		Title:      fmt.Sprintf("%s %s", event.GetRepo().GetFullName(), name),
+		TitleLink:  release.GetHTMLURL(),
+		Text:       truncateRunes(release.GetBody(), maxCardDescription),
+		Fallback:   fmt.Sprintf("%s: %s %s", pretext, event.GetRepo().GetFullName(), name),
+	}, true
+
+}
@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/eveisesi/eb2"
+	"github.com/google/go-github/v29/github"
+	nslack "github.com/nlopes/slack"
+)
+
+func TestProcessGithubEventRoutesByEventType(t *testing.T) {
+
+	tests := []struct {
+		event   string
+		channel string
+		title   string
+	}{
+		{event: "issues", channel: "CISSUES", title: "esi/esi-issues#1204 GET /characters/{character_id}/skillqueue/ returns finished skills"},
+		{event: "issue_comment", channel: "CFEED", title: "esi/esi-issues#1204 GET /characters/{character_id}/skillqueue/ returns finished skills"},
+		{event: "release", channel: "CRELEASES", title: "esi/esi-docs ESI 1.8.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+
+			data, err := ioutil.ReadFile(filepath.Join("testdata", "github", tt.event+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload, err := github.ParseWebHook(tt.event, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			api := newSlackRecorder()
+			defer api.Close()
+
+			s := &service{
+				logger:  newTestLogger(),
+				goslack: api.client(),
+				config: &eb2.Config{
+					GithubFeedChannel: "CFEED",
+					GithubWebhookChannels: map[string]string{
+						"issues":  "CISSUES",
+						"release": "CRELEASES",
+					},
+				},
+			}
+
+			s.ProcessGithubEvent(context.Background(), tt.event, payload)
+
+			calls := api.recorded()
+			if len(calls) != 1 {
+				t.Fatalf("expected a single message to be posted, got %d", len(calls))
+			}
+			if calls[0].method != "chat.postMessage" {
+				t.Fatalf("expected chat.postMessage to be called, got %s", calls[0].method)
+			}
+			if channel := calls[0].form.Get("channel"); channel != tt.channel {
+				t.Errorf("expected the event to be posted to %s, got %s", tt.channel, channel)
+			}
+
+			var attachments []nslack.Attachment
+			err = json.Unmarshal([]byte(calls[0].form.Get("attachments")), &attachments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(attachments) != 1 || attachments[0].Title != tt.title {
+				t.Errorf("expected an attachment titled %q, got %+v", tt.title, attachments)
+			}
+
+		})
+	}
+
+}